@@ -0,0 +1,136 @@
+// Package certs loads the TLS certificate of the server and reloads it when
+// its files change, so renewed certificates are served without a restart.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// Reloader serves the certificate loaded from a cert and key file pair
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// ReloaderInit loads the certificate, failing if the files can't be read or
+// don't make a valid pair
+func ReloaderInit(certFile string, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, it's meant to be the
+// GetCertificate of the tls.Config of the server
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Run checks the files every interval and reloads the certificate when
+// either changed, until ctx is done. A pair that fails to load is logged and
+// the previous certificate is kept, it's tried again on the next change
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				logging.FromContext(ctx).Error("Error reloading the TLS certificate", "cert_file", r.certFile, "error", err)
+				continue
+			}
+			if reloaded {
+				logging.FromContext(ctx).Info("Reloaded the TLS certificate", "cert_file", r.certFile, "not_after", r.notAfter())
+			}
+		}
+	}
+}
+
+// reload loads the pair if its files changed since the last load. The last
+// change of either file is what's compared, so renewing both is one reload
+func (r *Reloader) reload() (bool, error) {
+	modTime, err := lastModified(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return true, nil
+}
+
+// notAfter returns when the current certificate expires
+func (r *Reloader) notAfter() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert.Leaf != nil {
+		return r.cert.Leaf.NotAfter
+	}
+	leaf, err := x509.ParseCertificate(r.cert.Certificate[0])
+	if err != nil {
+		return time.Time{}
+	}
+	return leaf.NotAfter
+}
+
+// lastModified returns the latest modification time of the files
+func lastModified(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("%s: %w", file, util.ErrNoCertificates)
+	}
+	return pool, nil
+}
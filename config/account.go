@@ -0,0 +1,21 @@
+package config
+
+import (
+	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/worker"
+)
+
+// GetDeleteGracePeriod returns how long deleted accounts can be restored
+func GetDeleteGracePeriod(cfg Config) service.DeleteGracePeriod {
+	return service.DeleteGracePeriod(cfg.DeleteGracePeriod)
+}
+
+// GetPurgeInterval returns how often the expired accounts are purged
+func GetPurgeInterval(cfg Config) worker.PurgeInterval {
+	return worker.PurgeInterval(cfg.PurgeInterval)
+}
+
+// GetAuditHashChain returns if the audit events are chained with hashes
+func GetAuditHashChain(cfg Config) service.AuditHashChain {
+	return service.AuditHashChain(cfg.AuditHashChain)
+}
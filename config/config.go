@@ -0,0 +1,469 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"ignaciofp.es/web-service-portfolio/middleware"
+)
+
+// Config is every setting of the app. It's loaded once at startup by Load and
+// handed to the providers of the wire graph
+type Config struct {
+	Mode            string
+	LogLevel        slog.Level
+	Port            int
+	MetricsPort     int
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	ShutdownDelay   time.Duration
+
+	Storage       Storage
+	MongoURI      string
+	MongoDatabase string
+	MongoIndexes  string
+
+	DeleteGracePeriod time.Duration
+	PurgeInterval     time.Duration
+	AuditHashChain    bool
+	EventSinks        []string
+	TraceExporter     string
+
+	LegacyDeprecatedAt time.Time
+	LegacySunset       time.Time
+
+	CORSAllowOrigins      []string
+	CORSAdminAllowOrigins []string
+	CORSAllowMethods      []string
+	CORSAllowHeaders      []string
+	CORSAllowCredentials  bool
+	CORSMaxAge            time.Duration
+
+	HSTSMaxAge   time.Duration
+	MaxBodyBytes int64
+
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   uint16
+	TLSCipherSuites []uint16
+	TLSClientCAFile string
+
+	TrustedProxies []netip.Prefix
+	ClientIPHeader string
+}
+
+// setting is a single key of the config. The key is the env variable, the
+// config file key and, lowercased with dashes, the flag
+type setting struct {
+	key          string
+	defaultValue string
+	usage        string
+	parse        func(cfg *Config, value string) error
+}
+
+var settings = []setting{
+	{"MODE", "release", "gin mode: release, debug or test", oneOf(func(c *Config) *string { return &c.Mode }, "release", "debug", "test")},
+	{"LOG_LEVEL", "info", "lowest level logged: debug, info, warn or error", logLevel(func(c *Config) *slog.Level { return &c.LogLevel })},
+	{"PORT", "8080", "port the server listens on", port(func(c *Config) *int { return &c.Port })},
+	{"METRICS_PORT", "9090", "port of the internal listener serving /metrics, keep it off the public network", port(func(c *Config) *int { return &c.MetricsPort })},
+	{"READ_TIMEOUT", "15s", "how long reading a request may take", duration(func(c *Config) *time.Duration { return &c.ReadTimeout })},
+	{"WRITE_TIMEOUT", "30s", "how long writing a response may take", duration(func(c *Config) *time.Duration { return &c.WriteTimeout })},
+	{"IDLE_TIMEOUT", "2m", "how long idle keep-alive connections are kept", duration(func(c *Config) *time.Duration { return &c.IdleTimeout })},
+	{"SHUTDOWN_TIMEOUT", "30s", "how long requests in flight and workers get to finish when stopping", duration(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+	{"SHUTDOWN_DELAY", "0s", "how long readiness fails before the server stops, so load balancers stop sending requests", delay(func(c *Config) *time.Duration { return &c.ShutdownDelay })},
+	{"STORAGE", string(StorageMongo), "storage: mongo or memory", oneOf(func(c *Config) *string { return (*string)(&c.Storage) }, string(StorageMongo), string(StorageMemory))},
+	{"MONGO_URI", "", "mongo connection uri", text(func(c *Config) *string { return &c.MongoURI })},
+	{"MONGO_DATABASE", "", "mongo database name", text(func(c *Config) *string { return &c.MongoDatabase })},
+	{"MONGO_INDEXES", "ensure", "index mode: ensure or check", oneOf(func(c *Config) *string { return &c.MongoIndexes }, "ensure", "check")},
+	{"DELETE_GRACE_PERIOD", "720h", "how long deleted accounts can be restored", duration(func(c *Config) *time.Duration { return &c.DeleteGracePeriod })},
+	{"PURGE_INTERVAL", "1h", "how often expired accounts are purged", duration(func(c *Config) *time.Duration { return &c.PurgeInterval })},
+	{"AUDIT_HASH_CHAIN", "false", "chain the audit events with hashes", boolean(func(c *Config) *bool { return &c.AuditHashChain })},
+	{"EVENT_SINKS", "", "domain event sinks besides webhooks, separated by commas: log", list(func(c *Config) *[]string { return &c.EventSinks }, "log")},
+	{"LEGACY_DEPRECATED_AT", "2026-10-19T00:00:00Z", "when the routes without version prefix were deprecated, RFC 3339", date(func(c *Config) *time.Time { return &c.LegacyDeprecatedAt })},
+	{"LEGACY_SUNSET", "", "when the routes without version prefix stop being served, RFC 3339, unset while not decided", date(func(c *Config) *time.Time { return &c.LegacySunset })},
+	{"CORS_ALLOW_ORIGINS", "", "origins browsers may send requests from, separated by commas: exact, * for any, wildcards like https://*.example.com or regular expressions starting with ~ matching the whole origin", origins(func(c *Config) *[]string { return &c.CORSAllowOrigins })},
+	{"CORS_ADMIN_ALLOW_ORIGINS", "", "origins browsers may send requests to the admin routes from, like CORS_ALLOW_ORIGINS", origins(func(c *Config) *[]string { return &c.CORSAdminAllowOrigins })},
+	{"CORS_ALLOW_METHODS", "GET,POST,PUT,DELETE", "methods cross-origin requests may use, separated by commas", names(func(c *Config) *[]string { return &c.CORSAllowMethods })},
+	{"CORS_ALLOW_HEADERS", "Content-Type,Token,X-Request-ID", "headers cross-origin requests may send, separated by commas", names(func(c *Config) *[]string { return &c.CORSAllowHeaders })},
+	{"CORS_ALLOW_CREDENTIALS", "false", "let cross-origin requests send cookies and credentials", boolean(func(c *Config) *bool { return &c.CORSAllowCredentials })},
+	{"CORS_MAX_AGE", "12h", "how long browsers may cache preflight responses", duration(func(c *Config) *time.Duration { return &c.CORSMaxAge })},
+	{"HSTS_MAX_AGE", "0s", "how long browsers must only use HTTPS with the API, 0s doesn't send the header", delay(func(c *Config) *time.Duration { return &c.HSTSMaxAge })},
+	{"MAX_BODY_BYTES", "65536", "largest request body accepted, in bytes", size(func(c *Config) *int64 { return &c.MaxBodyBytes })},
+	{"TLS_CERT_FILE", "", "PEM certificate served over HTTPS, HTTP is served if unset. Reloaded when it changes", text(func(c *Config) *string { return &c.TLSCertFile })},
+	{"TLS_KEY_FILE", "", "PEM private key of the certificate", text(func(c *Config) *string { return &c.TLSKeyFile })},
+	{"TLS_MIN_VERSION", "1.2", "lowest TLS version accepted: 1.2 or 1.3", tlsVersion(func(c *Config) *uint16 { return &c.TLSMinVersion })},
+	{"TLS_CIPHER_SUITES", "", "TLS 1.2 cipher suites accepted, separated by commas, Go's defaults if unset", cipherSuites(func(c *Config) *[]uint16 { return &c.TLSCipherSuites })},
+	{"TLS_CLIENT_CA_FILE", "", "PEM CA bundle of client certificates, when set the admin routes require one", text(func(c *Config) *string { return &c.TLSClientCAFile })},
+	{"TRUSTED_PROXIES", "", "networks of the proxies trusted to tell the client address, separated by commas, like 10.0.0.0/8 or 192.168.1.10. None if unset", networks(func(c *Config) *[]netip.Prefix { return &c.TrustedProxies })},
+	{"CLIENT_IP_HEADER", middleware.XForwardedForHeader, "header the trusted proxies tell the client address in: Forwarded, X-Forwarded-For or X-Real-IP", oneOf(func(c *Config) *string { return &c.ClientIPHeader }, middleware.ForwardedHeader, middleware.XForwardedForHeader, middleware.XRealIPHeader)},
+	{"TRACE_EXPORTER", "none", "where traces are sent: none, stdout (JSON lines on stderr) or otlp", oneOf(func(c *Config) *string { return &c.TraceExporter }, "none", "stdout", "otlp")},
+}
+
+// Load reads the config from, in increasing precedence: the defaults, the
+// config file (-config flag or CONFIG_FILE env variable), the .env file if it
+// exists, the environment and the flags in args. A setting that is present
+// but empty is an empty value, so it clears the value of an earlier source.
+// Every invalid setting is reported in the returned error. The args left
+// after the flags are returned
+func Load(args []string) (Config, []string, error) {
+	flags := flag.NewFlagSet("app", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "JSON config file with the settings by their env variable name")
+	for _, s := range settings {
+		flags.String(flagName(s.key), "", fmt.Sprintf("%s (env %s, default %q)", s.usage, s.key, s.defaultValue))
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	values := map[string]string{}
+	for _, s := range settings {
+		values[s.key] = s.defaultValue
+	}
+
+	var errs []error
+	if *configFile != "" {
+		fileValues, err := readConfigFile(*configFile)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("config file %s: %w", *configFile, err)
+		}
+		for key, value := range fileValues {
+			if _, ok := values[key]; !ok {
+				errs = append(errs, fmt.Errorf("config file %s: unknown setting %s", *configFile, key))
+				continue
+			}
+			values[key] = value
+		}
+	}
+
+	// A missing .env is fine, the settings may come from the environment
+	dotenv, err := godotenv.Read(".env")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, nil, fmt.Errorf(".env: %w", err)
+	}
+	for _, s := range settings {
+		if value, ok := dotenv[s.key]; ok {
+			values[s.key] = value
+		}
+		if value, ok := os.LookupEnv(s.key); ok {
+			values[s.key] = value
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if flagName(s.key) == f.Name {
+				values[s.key] = f.Value.String()
+			}
+		}
+	})
+
+	var cfg Config
+	for _, s := range settings {
+		if err := s.parse(&cfg, values[s.key]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.key, err))
+		}
+	}
+	errs = append(errs, cfg.validate()...)
+	return cfg, flags.Args(), errors.Join(errs...)
+}
+
+// validate checks the settings that depend on each other
+func (c Config) validate() []error {
+	var errs []error
+	if c.Storage == StorageMongo {
+		if c.MongoURI == "" {
+			errs = append(errs, errors.New("MONGO_URI: required with the mongo storage"))
+		}
+		if c.MongoDatabase == "" {
+			errs = append(errs, errors.New("MONGO_DATABASE: required with the mongo storage"))
+		}
+	}
+	if c.MetricsPort == c.Port {
+		errs = append(errs, errors.New("METRICS_PORT: must differ from PORT, the metrics aren't served on the public listener"))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE, TLS_KEY_FILE: both are required to serve HTTPS"))
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, errors.New("TLS_CLIENT_CA_FILE: client certificates need HTTPS, set TLS_CERT_FILE and TLS_KEY_FILE"))
+	}
+	if len(c.TLSCipherSuites) > 0 {
+		if c.TLSMinVersion == tls.VersionTLS13 {
+			errs = append(errs, errors.New("TLS_CIPHER_SUITES: TLS 1.3 suites are not configurable, only set them with TLS_MIN_VERSION 1.2"))
+		}
+		// HTTP/2 refuses to start without one of them
+		if !slices.Contains(c.TLSCipherSuites, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) && !slices.Contains(c.TLSCipherSuites, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256) {
+			errs = append(errs, errors.New("TLS_CIPHER_SUITES: HTTP/2 needs TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"))
+		}
+	}
+	if c.CORSAllowCredentials {
+		for _, origins := range [][]string{c.CORSAllowOrigins, c.CORSAdminAllowOrigins} {
+			for _, origin := range origins {
+				if origin == "*" {
+					errs = append(errs, errors.New("CORS_ALLOW_CREDENTIALS: can't be used when any origin (*) is allowed"))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// readConfigFile reads a JSON object of settings. Values may be strings,
+// numbers, booleans or, for lists, arrays of strings
+func readConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// flagName turns a setting key like MONGO_URI into its flag, mongo-uri
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// The parsers below store the value of a setting in the field of the config
+// they are given, or return why the value is invalid
+
+func text(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func oneOf(field func(*Config) *string, allowed ...string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		for _, a := range allowed {
+			if value == a {
+				*field(c) = value
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid value %q, must be one of %s", value, strings.Join(allowed, ", "))
+	}
+}
+
+func port(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func duration(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration %q, must be positive like \"72h\"", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func delay(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid duration %q, must be zero or positive like \"5s\"", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func size(field func(*Config) *int64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid size %q, must be a positive number of bytes", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func networks(field func(*Config) *[]netip.Prefix) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var items []string
+		if err := names(func(*Config) *[]string { return &items })(c, value); err != nil {
+			return err
+		}
+		var prefixes []netip.Prefix
+		for _, item := range items {
+			// A single address is a network of its own
+			if addr, err := netip.ParseAddr(item); err == nil {
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return fmt.Errorf("invalid network %q, must be an address or CIDR like 10.0.0.0/8", item)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+		*field(c) = prefixes
+		return nil
+	}
+}
+
+func tlsVersion(field func(*Config) *uint16) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		switch value {
+		case "1.2":
+			*field(c) = tls.VersionTLS12
+		case "1.3":
+			*field(c) = tls.VersionTLS13
+		default:
+			return fmt.Errorf("invalid TLS version %q, must be one of 1.2, 1.3", value)
+		}
+		return nil
+	}
+}
+
+func cipherSuites(field func(*Config) *[]uint16) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var suiteNames []string
+		if err := names(func(*Config) *[]string { return &suiteNames })(c, value); err != nil {
+			return err
+		}
+		// Only the suites Go considers secure are accepted. Nil keeps the
+		// defaults of Go
+		var suites []uint16
+		for _, name := range suiteNames {
+			i := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name })
+			if i < 0 {
+				return fmt.Errorf("unknown or insecure cipher suite %q", name)
+			}
+			suites = append(suites, tls.CipherSuites()[i].ID)
+		}
+		*field(c) = suites
+		return nil
+	}
+}
+
+func boolean(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func names(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}
+}
+
+func origins(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var items []string
+		if err := names(func(*Config) *[]string { return &items })(c, value); err != nil {
+			return err
+		}
+		if _, err := middleware.OriginMatcher(items); err != nil {
+			return err
+		}
+		*field(c) = items
+		return nil
+	}
+}
+
+func date(field func(*Config) *time.Time) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		if value == "" {
+			*field(c) = time.Time{}
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, must be RFC 3339 like \"2025-01-31T00:00:00Z\"", value)
+		}
+		*field(c) = t
+		return nil
+	}
+}
+
+func logLevel(field func(*Config) *slog.Level) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid log level %q, must be one of debug, info, warn, error", value)
+		}
+		*field(c) = level
+		return nil
+	}
+}
+
+func list(field func(*Config) *[]string, allowed ...string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			if err := oneOf(func(*Config) *string { return &item }, allowed...)(c, item); err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		*field(c) = items
+		return nil
+	}
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// isolate runs the test in an empty directory, without .env, and with none of
+// the settings in the environment
+func isolate(t *testing.T) string {
+	t.Helper()
+	for _, key := range append([]string{"CONFIG_FILE"}, settingKeys()...) {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd error = %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir error = %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func settingKeys() []string {
+	keys := make([]string, 0, len(settings))
+	for _, s := range settings {
+		keys = append(keys, s.key)
+	}
+	return keys
+}
+
+// writeFile writes content in the file of dir and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		dotenv      string
+		env         map[string]string
+		args        []string
+		wantPort    int
+		wantOrigins []string
+	}{
+		{
+			name:        "defaults",
+			wantPort:    8080,
+			wantOrigins: []string{},
+		},
+		{
+			name:        "file over defaults",
+			file:        `{"PORT": 8081, "CORS_ALLOW_ORIGINS": ["https://a.example.com", "https://b.example.com"]}`,
+			wantPort:    8081,
+			wantOrigins: []string{"https://a.example.com", "https://b.example.com"},
+		},
+		{
+			name:        "file from CONFIG_FILE",
+			file:        `{"PORT": 8081}`,
+			env:         map[string]string{"CONFIG_FILE": "config.json"},
+			wantPort:    8081,
+			wantOrigins: []string{},
+		},
+		{
+			name:        ".env over file",
+			file:        `{"PORT": 8081, "CORS_ALLOW_ORIGINS": ["https://a.example.com"]}`,
+			dotenv:      "PORT=8082\n",
+			wantPort:    8082,
+			wantOrigins: []string{"https://a.example.com"},
+		},
+		{
+			name:        "env over .env",
+			file:        `{"PORT": 8081}`,
+			dotenv:      "PORT=8082\nCORS_ALLOW_ORIGINS=https://a.example.com\n",
+			env:         map[string]string{"PORT": "8083"},
+			wantPort:    8083,
+			wantOrigins: []string{"https://a.example.com"},
+		},
+		{
+			name:        "flags over env",
+			file:        `{"PORT": 8081}`,
+			dotenv:      "PORT=8082\n",
+			env:         map[string]string{"PORT": "8083", "CORS_ALLOW_ORIGINS": "https://a.example.com"},
+			args:        []string{"-port", "8084", "-cors-allow-origins", "https://b.example.com"},
+			wantPort:    8084,
+			wantOrigins: []string{"https://b.example.com"},
+		},
+		{
+			name:        "empty env clears the file",
+			file:        `{"CORS_ALLOW_ORIGINS": ["https://a.example.com"]}`,
+			env:         map[string]string{"CORS_ALLOW_ORIGINS": ""},
+			wantPort:    8080,
+			wantOrigins: []string{},
+		},
+		{
+			name:        "empty flag clears the env",
+			env:         map[string]string{"CORS_ALLOW_ORIGINS": "https://a.example.com"},
+			args:        []string{"-cors-allow-origins="},
+			wantPort:    8080,
+			wantOrigins: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := isolate(t)
+			args := []string{"-storage", "memory"}
+			if tt.file != "" {
+				path := writeFile(t, dir, "config.json", tt.file)
+				if tt.env["CONFIG_FILE"] == "" {
+					args = append(args, "-config", path)
+				}
+			}
+			if tt.dotenv != "" {
+				writeFile(t, dir, ".env", tt.dotenv)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, _, err := Load(append(args, tt.args...))
+			if err != nil {
+				t.Fatalf("Load error = %v", err)
+			}
+			if cfg.Port != tt.wantPort {
+				t.Errorf("Port = %d, want %d", cfg.Port, tt.wantPort)
+			}
+			if !slices.Equal(cfg.CORSAllowOrigins, tt.wantOrigins) {
+				t.Errorf("CORSAllowOrigins = %q, want %q", cfg.CORSAllowOrigins, tt.wantOrigins)
+			}
+		})
+	}
+}
+
+func TestLoadArgs(t *testing.T) {
+	isolate(t)
+	_, args, err := Load([]string{"-storage", "memory", "openapi", "check"})
+	if err != nil {
+		t.Fatalf("Load error = %v", err)
+	}
+	if !slices.Equal(args, []string{"openapi", "check"}) {
+		t.Errorf("args = %q, want the ones after the flags", args)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		args []string
+		// want are the errors expected, in order, each by a part of its message
+		want []string
+	}{
+		{
+			name: "valid",
+			args: []string{"-storage", "memory"},
+		},
+		{
+			name: "mongo without uri nor database",
+			want: []string{"MONGO_URI: required", "MONGO_DATABASE: required"},
+		},
+		{
+			name: "every invalid value",
+			args: []string{"-storage", "disk", "-port", "http", "-log-level", "loud", "-read-timeout", "soon"},
+			want: []string{
+				`LOG_LEVEL: invalid log level "loud"`,
+				`PORT: invalid port "http"`,
+				`READ_TIMEOUT: invalid`,
+				`STORAGE: invalid value "disk"`,
+			},
+		},
+		{
+			name: "unknown setting in the file",
+			file: `{"STORAGE": "memory", "COLOUR": "blue"}`,
+			want: []string{"unknown setting COLOUR"},
+		},
+		{
+			name: "metrics on the public port",
+			args: []string{"-storage", "memory", "-port", "8080", "-metrics-port", "8080"},
+			want: []string{"METRICS_PORT: must differ from PORT"},
+		},
+		{
+			name: "certificate without key",
+			args: []string{"-storage", "memory", "-tls-cert-file", "cert.pem"},
+			want: []string{"TLS_CERT_FILE, TLS_KEY_FILE: both are required"},
+		},
+		{
+			name: "client certificates without HTTPS",
+			args: []string{"-storage", "memory", "-tls-client-ca-file", "ca.pem"},
+			want: []string{"TLS_CLIENT_CA_FILE: client certificates need HTTPS"},
+		},
+		{
+			name: "cipher suites with TLS 1.3",
+			args: []string{"-storage", "memory", "-tls-min-version", "1.3", "-tls-cipher-suites", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			want: []string{"TLS_CIPHER_SUITES: TLS 1.3 suites are not configurable"},
+		},
+		{
+			name: "cipher suites without the HTTP/2 ones",
+			args: []string{"-storage", "memory", "-tls-cipher-suites", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+			want: []string{"TLS_CIPHER_SUITES: HTTP/2 needs"},
+		},
+		{
+			name: "credentials with any origin",
+			args: []string{"-storage", "memory", "-cors-allow-credentials", "true", "-cors-admin-allow-origins", "*"},
+			want: []string{"CORS_ALLOW_CREDENTIALS: can't be used when any origin (*) is allowed"},
+		},
+		{
+			name: "invalid values and dependent settings",
+			args: []string{"-port", "0", "-tls-key-file", "key.pem"},
+			want: []string{
+				`PORT: invalid port "0"`,
+				"MONGO_URI: required",
+				"MONGO_DATABASE: required",
+				"TLS_CERT_FILE, TLS_KEY_FILE: both are required",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := isolate(t)
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, dir, "config.json", tt.file)}, args...)
+			}
+
+			_, _, err := Load(args)
+			var errs []error
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				errs = joined.Unwrap()
+			} else if err != nil {
+				errs = []error{err}
+			}
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Load errors = %v, want %d: %q", errs, len(tt.want), tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("error %d = %q, want it to contain %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadInvalidConfigFile(t *testing.T) {
+	dir := isolate(t)
+	for name, content := range map[string]string{"missing.json": "", "broken.json": `{"PORT": `} {
+		path := filepath.Join(dir, name)
+		if content != "" {
+			writeFile(t, dir, name, content)
+		}
+		if _, _, err := Load([]string{"-config", path}); err == nil {
+			t.Errorf("Load with %s error = nil, want an error", name)
+		}
+	}
+}
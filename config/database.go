@@ -2,25 +2,92 @@ package config
 
 import (
 	"context"
-	"log"
-	"os"
+	"log/slog"
+	"time"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/repository"
 )
 
-// ConnectToDB connects to the database using the provided uri and database name in the .env file and returns the database
-func ConnectToDB() *mongo.Database {
-	ctx := context.TODO()
-	uri := os.Getenv("MONGO_URI")
-	dbName := os.Getenv("MONGO_DATABASE")
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+// connectTimeout is how long connecting to the database may take
+const connectTimeout = 10 * time.Second
+
+// ConnectToDB connects to the database using the configured uri and database name and returns the database.
+// The monitor, if any, sees every command sent. The caller must disconnect its client
+func ConnectToDB(cfg Config, monitor *event.CommandMonitor) *mongo.Database {
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	uri := cfg.MongoURI
+	dbName := cfg.MongoDatabase
+	opts := options.Client().ApplyURI(uri)
+	if monitor != nil {
+		opts.SetMonitor(monitor)
+	}
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
-		log.Fatal("Error connecting to database. Error: ", err)
+		logging.Fatal("Error connecting to database", "error", err)
 	}
 	if err := client.Ping(ctx, readpref.Primary()); err != nil {
-		log.Fatal("Error connecting to database. Error: ", err)
+		logging.Fatal("Error connecting to database", "error", err)
 	}
 	return client.Database(dbName)
 }
+
+// commandMonitors returns a monitor that passes every command event to all
+// the monitors, the driver only takes one
+func commandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				m.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				m.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				m.Failed(ctx, e)
+			}
+		},
+	}
+}
+
+// SetupIndexes makes sure the database has the indexes the repositories need.
+// With the "check" mode the differences are only reported, with "ensure"
+// missing and changed indexes are (re)created
+func SetupIndexes(db *mongo.Database, mode string) {
+	ctx := context.TODO()
+
+	switch mode {
+	case "check":
+		drifts, err := repository.CheckIndexes(ctx, db, repository.Indexes)
+		if err != nil {
+			logging.Fatal("Error checking indexes", "error", err)
+		}
+		for _, drift := range drifts {
+			slog.Warn("Index drift", "index", drift.String())
+		}
+	case "ensure":
+		drifts, err := repository.EnsureIndexes(ctx, db, repository.Indexes)
+		if err != nil {
+			logging.Fatal("Error ensuring indexes", "error", err)
+		}
+		for _, drift := range drifts {
+			if drift.Problem == "undeclared" {
+				slog.Warn("Index drift", "index", drift.String())
+				continue
+			}
+			slog.Info("Index fixed", "index", drift.String())
+		}
+	default:
+		logging.Fatal("Unknown index mode, valid modes: ensure, check", "mode", mode)
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"ignaciofp.es/web-service-portfolio/event"
+	"ignaciofp.es/web-service-portfolio/repository"
+)
+
+// GetEventSinks returns the webhook and user stream sinks, which are always
+// enabled, and the configured event sinks
+func GetEventSinks(cfg Config, webhooks *event.WebhookSink, broadcaster *event.UserBroadcaster) []event.Sink {
+	sinks := []event.Sink{webhooks, broadcaster}
+	for _, name := range cfg.EventSinks {
+		switch name {
+		case "log":
+			sinks = append(sinks, event.LogSink{})
+		}
+	}
+	return sinks
+}
+
+// GetUserFeed returns the feed of the user streams. Mongo change streams see
+// the changes made by every instance of the app, the broadcaster is used when
+// they are not available
+func GetUserFeed(storage Storage, db *mongo.Database, broadcaster *event.UserBroadcaster) event.UserFeed {
+	if storage == StorageMemory {
+		return broadcaster
+	}
+	if !repository.SupportsChangeStreams(db) {
+		slog.Warn("MongoDB is a standalone server, user streams only get the changes made by this instance")
+		return broadcaster
+	}
+	return repository.UserChangeStreamInit(db)
+}
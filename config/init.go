@@ -1,31 +1,107 @@
 package config
 
 import (
+	"crypto/tls"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"ignaciofp.es/web-service-portfolio/controller"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+	"ignaciofp.es/web-service-portfolio/metrics"
+	"ignaciofp.es/web-service-portfolio/middleware"
 	"ignaciofp.es/web-service-portfolio/repository"
 	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/worker"
 )
 
 type Initialization struct {
-	userRepo repository.UserRepository
-	userSvc  service.UserService
-	UserCtrl controller.UserController
-	authSvc  service.AuthService
-	AuthCtrl controller.AuthController
+	Lifecycle     *lifecycle.Lifecycle
+	userRepo      repository.UserRepository
+	userSvc       service.UserService
+	UserCtrl      controller.UserController
+	authSvc       service.AuthService
+	AuthCtrl      controller.AuthController
+	rewardRepo    repository.RewardRepository
+	rewardSvc     service.RewardService
+	RewardCtrl    controller.RewardController
+	AuthMw        middleware.AuthMiddleware
+	DeprecationMw middleware.DeprecationMiddleware
+	purgeSvc      service.PurgeService
+	Purger        *worker.Purger
+	auditRepo     repository.AuditRepository
+	auditSvc      service.AuditService
+	AuditCtrl     controller.AuditController
+	Dispatcher    *worker.Dispatcher
+	webhookRepo   repository.WebhookRepository
+	webhookSvc    service.WebhookService
+	WebhookCtrl   controller.WebhookController
+	WebhookSender *worker.WebhookSender
+	HealthCtrl    controller.HealthController
+	Metrics       *metrics.Metrics
+	Tracer        *sdktrace.TracerProvider
+	CORS          CORSPolicies
+	Security      middleware.SecurityPolicy
+	TLS           *tls.Config
+	Proxies       middleware.ProxyPolicy
 }
 
 func NewInitialization(
+	lc *lifecycle.Lifecycle,
 	userRepo repository.UserRepository,
 	userSvc service.UserService,
 	userCtrl controller.UserController,
 	authSvc service.AuthService,
 	authCtrl controller.AuthController,
+	rewardRepo repository.RewardRepository,
+	rewardSvc service.RewardService,
+	rewardCtrl controller.RewardController,
+	authMw middleware.AuthMiddleware,
+	deprecationMw middleware.DeprecationMiddleware,
+	purgeSvc service.PurgeService,
+	purger *worker.Purger,
+	auditRepo repository.AuditRepository,
+	auditSvc service.AuditService,
+	auditCtrl controller.AuditController,
+	dispatcher *worker.Dispatcher,
+	webhookRepo repository.WebhookRepository,
+	webhookSvc service.WebhookService,
+	webhookCtrl controller.WebhookController,
+	webhookSender *worker.WebhookSender,
+	healthCtrl controller.HealthController,
+	metrics *metrics.Metrics,
+	tracer *sdktrace.TracerProvider,
+	cors CORSPolicies,
+	security middleware.SecurityPolicy,
+	tlsConfig *tls.Config,
+	proxies middleware.ProxyPolicy,
 ) *Initialization {
 	return &Initialization{
-		userRepo: userRepo,
-		userSvc:  userSvc,
-		UserCtrl: userCtrl,
-		authSvc:  authSvc,
-		AuthCtrl: authCtrl,
+		Lifecycle:     lc,
+		userRepo:      userRepo,
+		userSvc:       userSvc,
+		UserCtrl:      userCtrl,
+		authSvc:       authSvc,
+		AuthCtrl:      authCtrl,
+		rewardRepo:    rewardRepo,
+		rewardSvc:     rewardSvc,
+		RewardCtrl:    rewardCtrl,
+		AuthMw:        authMw,
+		DeprecationMw: deprecationMw,
+		purgeSvc:      purgeSvc,
+		Purger:        purger,
+		auditRepo:     auditRepo,
+		auditSvc:      auditSvc,
+		AuditCtrl:     auditCtrl,
+		Dispatcher:    dispatcher,
+		webhookRepo:   webhookRepo,
+		webhookSvc:    webhookSvc,
+		WebhookCtrl:   webhookCtrl,
+		WebhookSender: webhookSender,
+		HealthCtrl:    healthCtrl,
+		Metrics:       metrics,
+		Tracer:        tracer,
+		CORS:          cors,
+		Security:      security,
+		TLS:           tlsConfig,
+		Proxies:       proxies,
 	}
 }
@@ -7,21 +7,26 @@ package config
 import (
 	"github.com/google/wire"
 	"ignaciofp.es/web-service-portfolio/controller"
-	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/event"
+	"ignaciofp.es/web-service-portfolio/health"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+	"ignaciofp.es/web-service-portfolio/metrics"
+	"ignaciofp.es/web-service-portfolio/middleware"
 	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/worker"
 )
 
-var db = wire.NewSet(ConnectToDB)
+var db = wire.NewSet(GetStorage, GetDatabase, lifecycle.LifecycleInit, health.RegistryInit, metrics.MetricsInit, GetTracerProvider)
 
-var userRepoSet = wire.NewSet(repository.UserRepositoryInit,
-	wire.Bind(new(repository.UserRepository), new(*repository.UserRepositoryImpl)),
-)
+var httpSet = wire.NewSet(GetCORSPolicies, GetSecurityPolicy, GetTLSConfig, GetProxyPolicy)
+
+var userRepoSet = wire.NewSet(GetUserRepository)
 
 var userServiceSet = wire.NewSet(service.UserServiceInit,
 	wire.Bind(new(service.UserService), new(*service.UserServiceImpl)),
 )
 
-var userCtrlSet = wire.NewSet(controller.UserControllerInit,
+var userCtrlSet = wire.NewSet(controller.UserControllerInit, GetUserFeed, event.UserBroadcasterInit,
 	wire.Bind(new(controller.UserController), new(*controller.UserControllerImpl)),
 )
 
@@ -33,7 +38,59 @@ var authCtrlSet = wire.NewSet(controller.AuthControllerInit,
 	wire.Bind(new(controller.AuthController), new(*controller.AuthControllerImpl)),
 )
 
-func Init() *Initialization {
-	wire.Build(NewInitialization, db, userCtrlSet, userServiceSet, userRepoSet, authServiceSet, authCtrlSet)
+var rewardRepoSet = wire.NewSet(GetRewardRepository)
+
+var rewardServiceSet = wire.NewSet(service.RewardServiceInit,
+	wire.Bind(new(service.RewardService), new(*service.RewardServiceImpl)),
+)
+
+var rewardCtrlSet = wire.NewSet(controller.RewardControllerInit,
+	wire.Bind(new(controller.RewardController), new(*controller.RewardControllerImpl)),
+)
+
+var authMwSet = wire.NewSet(middleware.AuthMiddlewareInit,
+	wire.Bind(new(middleware.AuthMiddleware), new(*middleware.AuthMiddlewareImpl)),
+)
+
+var deprecationMwSet = wire.NewSet(middleware.DeprecationMiddlewareInit, GetDeprecationPolicy,
+	wire.Bind(new(middleware.DeprecationMiddleware), new(*middleware.DeprecationMiddlewareImpl)),
+)
+
+var purgeServiceSet = wire.NewSet(service.PurgeServiceInit,
+	wire.Bind(new(service.PurgeService), new(*service.PurgeServiceImpl)),
+)
+
+var purgerSet = wire.NewSet(worker.PurgerInit, GetDeleteGracePeriod, GetPurgeInterval)
+
+var auditRepoSet = wire.NewSet(GetAuditRepository)
+
+var auditServiceSet = wire.NewSet(service.AuditServiceInit, GetAuditHashChain,
+	wire.Bind(new(service.AuditService), new(*service.AuditServiceImpl)),
+)
+
+var auditCtrlSet = wire.NewSet(controller.AuditControllerInit,
+	wire.Bind(new(controller.AuditController), new(*controller.AuditControllerImpl)),
+)
+
+var eventSet = wire.NewSet(GetOutboxRepository, GetTransactor, GetEventSinks, worker.DispatcherInit)
+
+var webhookRepoSet = wire.NewSet(GetWebhookRepository)
+
+var webhookServiceSet = wire.NewSet(service.WebhookServiceInit,
+	wire.Bind(new(service.WebhookService), new(*service.WebhookServiceImpl)),
+)
+
+var webhookCtrlSet = wire.NewSet(controller.WebhookControllerInit,
+	wire.Bind(new(controller.WebhookController), new(*controller.WebhookControllerImpl)),
+)
+
+var webhookSenderSet = wire.NewSet(event.WebhookSinkInit, worker.WebhookSenderInit)
+
+var healthCtrlSet = wire.NewSet(controller.HealthControllerInit,
+	wire.Bind(new(controller.HealthController), new(*controller.HealthControllerImpl)),
+)
+
+func Init(cfg Config) *Initialization {
+	wire.Build(NewInitialization, db, userCtrlSet, userServiceSet, userRepoSet, authServiceSet, authCtrlSet, rewardRepoSet, rewardServiceSet, rewardCtrlSet, authMwSet, deprecationMwSet, purgeServiceSet, purgerSet, auditRepoSet, auditServiceSet, auditCtrlSet, eventSet, webhookRepoSet, webhookServiceSet, webhookCtrlSet, webhookSenderSet, healthCtrlSet, httpSet)
 	return nil
 }
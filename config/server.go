@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/certs"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/middleware"
+)
+
+// certReloadInterval is how often the certificate files are checked for changes
+const certReloadInterval = 10 * time.Second
+
+// NewServer returns the http server of the app listening on the configured
+// port with the configured timeouts. It serves HTTPS, and HTTP/2, when
+// tlsConfig is not nil
+func NewServer(cfg Config, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// NewMetricsServer returns the internal http server serving handler on
+// /metrics. It listens on its own port, over plain HTTP, so the metrics can
+// be kept off the network the API is public on
+func NewMetricsServer(cfg Config, handler http.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.MetricsPort),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// GetTLSConfig returns the TLS config of the server, or nil to serve plain
+// HTTP when no certificate is configured. The certificate is reloaded when
+// its files change while the app runs. With a client CA, client certificates
+// are verified if sent, the admin routes refuse requests without one
+func GetTLSConfig(cfg Config, lc *lifecycle.Lifecycle) *tls.Config {
+	if cfg.TLSCertFile == "" {
+		return nil
+	}
+
+	reloader, err := certs.ReloaderInit(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		logging.Fatal("Error loading the TLS certificate", "error", err)
+	}
+	lc.Append(lifecycle.Worker("certificate reloader", func(ctx context.Context) {
+		reloader.Run(ctx, certReloadInterval)
+	}))
+
+	tlsConfig := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     cfg.TLSMinVersion,
+		CipherSuites:   cfg.TLSCipherSuites,
+	}
+	if cfg.TLSClientCAFile != "" {
+		pool, err := certs.LoadCertPool(cfg.TLSClientCAFile)
+		if err != nil {
+			logging.Fatal("Error loading the client CA", "error", err)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig
+}
+
+// GetDeprecationPolicy returns when the legacy routes were deprecated and
+// their sunset
+func GetDeprecationPolicy(cfg Config) middleware.DeprecationPolicy {
+	return middleware.DeprecationPolicy{DeprecatedAt: cfg.LegacyDeprecatedAt, Sunset: cfg.LegacySunset}
+}
+
+// CORSPolicies are the CORS policy of the API and the stricter one of the
+// admin routes, which only differs in the allowed origins
+type CORSPolicies struct {
+	API   middleware.CORSPolicy
+	Admin middleware.CORSPolicy
+}
+
+// GetCORSPolicies returns the configured CORS policies
+func GetCORSPolicies(cfg Config) CORSPolicies {
+	api := middleware.CORSPolicy{
+		AllowOrigins:     cfg.CORSAllowOrigins,
+		AllowMethods:     cfg.CORSAllowMethods,
+		AllowHeaders:     cfg.CORSAllowHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}
+	admin := api
+	admin.AllowOrigins = cfg.CORSAdminAllowOrigins
+	return CORSPolicies{API: api, Admin: admin}
+}
+
+// GetSecurityPolicy returns the hardening applied to every request
+func GetSecurityPolicy(cfg Config) middleware.SecurityPolicy {
+	return middleware.SecurityPolicy{
+		HSTSMaxAge:       cfg.HSTSMaxAge,
+		MaxBodyBytes:     cfg.MaxBodyBytes,
+		AdminClientCerts: cfg.TLSClientCAFile != "",
+	}
+}
+
+// GetProxyPolicy returns the proxies trusted to tell the client address
+func GetProxyPolicy(cfg Config) middleware.ProxyPolicy {
+	return middleware.ProxyPolicy{TrustedProxies: cfg.TrustedProxies, Header: cfg.ClientIPHeader}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"ignaciofp.es/web-service-portfolio/health"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+	"ignaciofp.es/web-service-portfolio/metrics"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/tracing"
+)
+
+// Storage is the backend where the repositories keep their data
+type Storage string
+
+const (
+	StorageMongo  Storage = "mongo"
+	StorageMemory Storage = "memory"
+)
+
+// GetStorage returns the configured storage
+func GetStorage(cfg Config) Storage {
+	return cfg.Storage
+}
+
+// GetDatabase connects to mongo and sets up its indexes unless the storage
+// is in memory, then it returns nil. The client is disconnected when the app
+// stops and readiness fails while the server can't be reached
+func GetDatabase(cfg Config, storage Storage, lc *lifecycle.Lifecycle, checks *health.Registry, metrics *metrics.Metrics) *mongo.Database {
+	if storage == StorageMemory {
+		return nil
+	}
+	db := ConnectToDB(cfg, commandMonitors(metrics.CommandMonitor(), tracing.CommandMonitor()))
+	lc.Append(lifecycle.Hook{
+		Name:   "mongo client",
+		OnStop: db.Client().Disconnect,
+	})
+	checks.Register("mongo", func(ctx context.Context) error {
+		return db.Client().Ping(ctx, readpref.Primary())
+	})
+	SetupIndexes(db, cfg.MongoIndexes)
+	return db
+}
+
+// GetUserRepository returns the user repository for the configured storage
+func GetUserRepository(storage Storage, db *mongo.Database) repository.UserRepository {
+	if storage == StorageMemory {
+		return repository.MemoryUserRepositoryInit()
+	}
+	return repository.UserRepositoryInit(db)
+}
+
+// GetRewardRepository returns the reward repository for the configured storage
+func GetRewardRepository(storage Storage, db *mongo.Database) repository.RewardRepository {
+	if storage == StorageMemory {
+		return repository.MemoryRewardRepositoryInit()
+	}
+	return repository.RewardRepositoryInit(db)
+}
+
+// GetAuditRepository returns the audit repository for the configured storage
+func GetAuditRepository(storage Storage, db *mongo.Database) repository.AuditRepository {
+	if storage == StorageMemory {
+		return repository.MemoryAuditRepositoryInit()
+	}
+	return repository.AuditRepositoryInit(db)
+}
+
+// GetWebhookRepository returns the webhook repository for the configured storage
+func GetWebhookRepository(storage Storage, db *mongo.Database) repository.WebhookRepository {
+	if storage == StorageMemory {
+		return repository.MemoryWebhookRepositoryInit()
+	}
+	return repository.WebhookRepositoryInit(db)
+}
+
+// GetOutboxRepository returns the outbox repository for the configured storage
+func GetOutboxRepository(storage Storage, db *mongo.Database) repository.OutboxRepository {
+	if storage == StorageMemory {
+		return repository.MemoryOutboxRepositoryInit()
+	}
+	return repository.OutboxRepositoryInit(db)
+}
+
+// GetTransactor returns the transactor for the configured storage. The memory
+// storage has no transactions
+func GetTransactor(storage Storage, db *mongo.Database) repository.Transactor {
+	if storage == StorageMemory {
+		return repository.NoTransactor{}
+	}
+	return repository.TransactorInit(db)
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/tracing"
+)
+
+// GetTracerProvider returns the tracer provider with the configured exporter.
+// The spans left in its buffer are flushed when the app stops
+func GetTracerProvider(cfg Config, lc *lifecycle.Lifecycle) *sdktrace.TracerProvider {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.TraceExporter {
+	case "stdout":
+		// A JSON line per span on stderr, stdout carries the JSON logs and
+		// spans mixed in would break the parsing of log collectors
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case "otlp":
+		// The endpoint, headers and TLS are read from the standard
+		// OTEL_EXPORTER_OTLP_* env variables
+		exporter, err = otlptracehttp.New(context.Background())
+	}
+	if err != nil {
+		logging.Fatal("Error creating the trace exporter", "error", err)
+	}
+
+	provider, err := tracing.ProviderInit(exporter)
+	if err != nil {
+		logging.Fatal("Error creating the tracer provider", "error", err)
+	}
+	lc.Append(lifecycle.Hook{
+		Name:   "tracer provider",
+		OnStop: provider.Shutdown,
+	})
+	return provider
+}
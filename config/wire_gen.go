@@ -9,33 +9,107 @@ package config
 import (
 	"github.com/google/wire"
 	"ignaciofp.es/web-service-portfolio/controller"
-	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/event"
+	"ignaciofp.es/web-service-portfolio/health"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+	"ignaciofp.es/web-service-portfolio/metrics"
+	"ignaciofp.es/web-service-portfolio/middleware"
 	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/worker"
 )
 
 // Injectors from injector.go:
 
-func Init() *Initialization {
-	database := ConnectToDB()
-	userRepositoryImpl := repository.UserRepositoryInit(database)
-	userServiceImpl := service.UserServiceInit(userRepositoryImpl)
-	userControllerImpl := controller.UserControllerInit(userServiceImpl)
-	authServiceImpl := service.AuthServiceInit(userServiceImpl)
+func Init(cfg Config) *Initialization {
+	lifecycleLifecycle := lifecycle.LifecycleInit()
+	storage := GetStorage(cfg)
+	registry := health.RegistryInit(lifecycleLifecycle)
+	metricsMetrics := metrics.MetricsInit()
+	database := GetDatabase(cfg, storage, lifecycleLifecycle, registry, metricsMetrics)
+	userRepository := GetUserRepository(storage, database)
+	deleteGracePeriod := GetDeleteGracePeriod(cfg)
+	auditRepository := GetAuditRepository(storage, database)
+	auditHashChain := GetAuditHashChain(cfg)
+	auditServiceImpl := service.AuditServiceInit(auditRepository, auditHashChain)
+	transactor := GetTransactor(storage, database)
+	outboxRepository := GetOutboxRepository(storage, database)
+	userServiceImpl := service.UserServiceInit(userRepository, deleteGracePeriod, auditServiceImpl, transactor, outboxRepository)
+	userBroadcaster := event.UserBroadcasterInit(userRepository)
+	userFeed := GetUserFeed(storage, database, userBroadcaster)
+	userControllerImpl := controller.UserControllerInit(userServiceImpl, userFeed, lifecycleLifecycle)
+	authServiceImpl := service.AuthServiceInit(userServiceImpl, auditServiceImpl, transactor, outboxRepository, metricsMetrics)
 	authControllerImpl := controller.AuthControllerInit(authServiceImpl)
-	initialization := NewInitialization(userRepositoryImpl, userServiceImpl, userControllerImpl, authServiceImpl, authControllerImpl)
+	rewardRepository := GetRewardRepository(storage, database)
+	rewardServiceImpl := service.RewardServiceInit(rewardRepository, userServiceImpl, userRepository, auditServiceImpl, transactor, outboxRepository)
+	rewardControllerImpl := controller.RewardControllerInit(rewardServiceImpl)
+	authMiddlewareImpl := middleware.AuthMiddlewareInit(userServiceImpl)
+	deprecationPolicy := GetDeprecationPolicy(cfg)
+	deprecationMiddlewareImpl := middleware.DeprecationMiddlewareInit(deprecationPolicy, metricsMetrics)
+	purgeServiceImpl := service.PurgeServiceInit(userRepository, rewardRepository, deleteGracePeriod)
+	purgeInterval := GetPurgeInterval(cfg)
+	purger := worker.PurgerInit(purgeServiceImpl, purgeInterval)
+	auditControllerImpl := controller.AuditControllerInit(auditServiceImpl)
+	webhookRepository := GetWebhookRepository(storage, database)
+	webhookSink := event.WebhookSinkInit(webhookRepository)
+	v := GetEventSinks(cfg, webhookSink, userBroadcaster)
+	dispatcher := worker.DispatcherInit(outboxRepository, v)
+	webhookServiceImpl := service.WebhookServiceInit(webhookRepository)
+	webhookControllerImpl := controller.WebhookControllerInit(webhookServiceImpl)
+	webhookSender := worker.WebhookSenderInit(webhookRepository)
+	healthControllerImpl := controller.HealthControllerInit(registry)
+	tracerProvider := GetTracerProvider(cfg, lifecycleLifecycle)
+	corsPolicies := GetCORSPolicies(cfg)
+	securityPolicy := GetSecurityPolicy(cfg)
+	config := GetTLSConfig(cfg, lifecycleLifecycle)
+	proxyPolicy := GetProxyPolicy(cfg)
+	initialization := NewInitialization(lifecycleLifecycle, userRepository, userServiceImpl, userControllerImpl, authServiceImpl, authControllerImpl, rewardRepository, rewardServiceImpl, rewardControllerImpl, authMiddlewareImpl, deprecationMiddlewareImpl, purgeServiceImpl, purger, auditRepository, auditServiceImpl, auditControllerImpl, dispatcher, webhookRepository, webhookServiceImpl, webhookControllerImpl, webhookSender, healthControllerImpl, metricsMetrics, tracerProvider, corsPolicies, securityPolicy, config, proxyPolicy)
 	return initialization
 }
 
 // injector.go:
 
-var db = wire.NewSet(ConnectToDB)
+var db = wire.NewSet(GetStorage, GetDatabase, lifecycle.LifecycleInit, health.RegistryInit, metrics.MetricsInit, GetTracerProvider)
 
-var userRepoSet = wire.NewSet(repository.UserRepositoryInit, wire.Bind(new(repository.UserRepository), new(*repository.UserRepositoryImpl)))
+var httpSet = wire.NewSet(GetCORSPolicies, GetSecurityPolicy, GetTLSConfig, GetProxyPolicy)
+
+var userRepoSet = wire.NewSet(GetUserRepository)
 
 var userServiceSet = wire.NewSet(service.UserServiceInit, wire.Bind(new(service.UserService), new(*service.UserServiceImpl)))
 
-var userCtrlSet = wire.NewSet(controller.UserControllerInit, wire.Bind(new(controller.UserController), new(*controller.UserControllerImpl)))
+var userCtrlSet = wire.NewSet(controller.UserControllerInit, GetUserFeed, event.UserBroadcasterInit, wire.Bind(new(controller.UserController), new(*controller.UserControllerImpl)))
 
 var authServiceSet = wire.NewSet(service.AuthServiceInit, wire.Bind(new(service.AuthService), new(*service.AuthServiceImpl)))
 
 var authCtrlSet = wire.NewSet(controller.AuthControllerInit, wire.Bind(new(controller.AuthController), new(*controller.AuthControllerImpl)))
+
+var rewardRepoSet = wire.NewSet(GetRewardRepository)
+
+var rewardServiceSet = wire.NewSet(service.RewardServiceInit, wire.Bind(new(service.RewardService), new(*service.RewardServiceImpl)))
+
+var rewardCtrlSet = wire.NewSet(controller.RewardControllerInit, wire.Bind(new(controller.RewardController), new(*controller.RewardControllerImpl)))
+
+var authMwSet = wire.NewSet(middleware.AuthMiddlewareInit, wire.Bind(new(middleware.AuthMiddleware), new(*middleware.AuthMiddlewareImpl)))
+
+var deprecationMwSet = wire.NewSet(middleware.DeprecationMiddlewareInit, GetDeprecationPolicy, wire.Bind(new(middleware.DeprecationMiddleware), new(*middleware.DeprecationMiddlewareImpl)))
+
+var purgeServiceSet = wire.NewSet(service.PurgeServiceInit, wire.Bind(new(service.PurgeService), new(*service.PurgeServiceImpl)))
+
+var purgerSet = wire.NewSet(worker.PurgerInit, GetDeleteGracePeriod, GetPurgeInterval)
+
+var auditRepoSet = wire.NewSet(GetAuditRepository)
+
+var auditServiceSet = wire.NewSet(service.AuditServiceInit, GetAuditHashChain, wire.Bind(new(service.AuditService), new(*service.AuditServiceImpl)))
+
+var auditCtrlSet = wire.NewSet(controller.AuditControllerInit, wire.Bind(new(controller.AuditController), new(*controller.AuditControllerImpl)))
+
+var eventSet = wire.NewSet(GetOutboxRepository, GetTransactor, GetEventSinks, worker.DispatcherInit)
+
+var webhookRepoSet = wire.NewSet(GetWebhookRepository)
+
+var webhookServiceSet = wire.NewSet(service.WebhookServiceInit, wire.Bind(new(service.WebhookService), new(*service.WebhookServiceImpl)))
+
+var webhookCtrlSet = wire.NewSet(controller.WebhookControllerInit, wire.Bind(new(controller.WebhookController), new(*controller.WebhookControllerImpl)))
+
+var webhookSenderSet = wire.NewSet(event.WebhookSinkInit, worker.WebhookSenderInit)
+
+var healthCtrlSet = wire.NewSet(controller.HealthControllerInit, wire.Bind(new(controller.HealthController), new(*controller.HealthControllerImpl)))
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// maxPerPage is the biggest page of audit events that can be requested
+const maxPerPage = 100
+
+type AuditController interface {
+	GetEvents(ctx *gin.Context)
+	VerifyChain(ctx *gin.Context)
+}
+
+type AuditControllerImpl struct {
+	service service.AuditService
+}
+
+func AuditControllerInit(service service.AuditService) *AuditControllerImpl {
+	return &AuditControllerImpl{service: service}
+}
+
+// GetEvents returns a page of audit events, newest first. Accepted query params:
+// action, actor, target, outcome, ip, from and to (RFC 3339 dates), page and per_page
+func (s AuditControllerImpl) GetEvents(ctx *gin.Context) {
+	page, err := strconv.ParseInt(ctx.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || page < 1 {
+		ctx.Error(util.ErrInvalidQueryParam.WithDetail("param", "page"))
+		return
+	}
+	perPage, err := strconv.ParseInt(ctx.DefaultQuery("per_page", "50"), 10, 64)
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		ctx.Error(util.ErrInvalidQueryParam.WithMessage("invalid per_page, must be between 1 and 100").WithDetail("param", "per_page"))
+		return
+	}
+
+	query := repository.AuditQuery{
+		Action:   model.AuditAction(ctx.Query("action")),
+		ActorID:  ctx.Query("actor"),
+		TargetID: ctx.Query("target"),
+		Outcome:  model.AuditOutcome(ctx.Query("outcome")),
+		IP:       ctx.Query("ip"),
+		Offset:   (page - 1) * perPage,
+		Limit:    perPage,
+	}
+	if query.From, err = parseTimeQuery(ctx, "from"); err != nil {
+		ctx.Error(util.ErrInvalidQueryParam.WithMessage("invalid from date, must be RFC 3339").WithDetail("param", "from"))
+		return
+	}
+	if query.To, err = parseTimeQuery(ctx, "to"); err != nil {
+		ctx.Error(util.ErrInvalidQueryParam.WithMessage("invalid to date, must be RFC 3339").WithDetail("param", "to"))
+		return
+	}
+
+	events, total, err := s.service.GetEvents(ctx, query)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"events":   events,
+		"page":     page,
+		"per_page": perPage,
+		"total":    total,
+	})
+}
+
+// VerifyChain checks that the audit events hash chain hasn't been tampered with
+func (s AuditControllerImpl) VerifyChain(ctx *gin.Context) {
+	status, err := s.service.VerifyChain(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, status)
+}
+
+// parseTimeQuery parses the RFC 3339 date in the query param, zero if it's not set
+func parseTimeQuery(ctx *gin.Context, key string) (time.Time, error) {
+	value := ctx.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +13,7 @@ type AuthController interface {
 	Authenticate(ctx *gin.Context)
 	Register(ctx *gin.Context)
 	Logout(ctx *gin.Context)
+	Restore(ctx *gin.Context)
 }
 
 type AuthControllerImpl struct {
@@ -34,7 +34,7 @@ func (s AuthControllerImpl) Authenticate(ctx *gin.Context) {
 	var loginReq request.Auth
 	err := ctx.ShouldBindJSON(&loginReq)
 	if err != nil && token == "" { // Check if token is provided to not return invalid request when login with token
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		ctx.Error(bindError(err))
 		return
 	}
 
@@ -45,19 +45,7 @@ func (s AuthControllerImpl) Authenticate(ctx *gin.Context) {
 
 	newToken, err := s.service.Authenticate(ctx, loginReq)
 	if err != nil {
-		if errors.Is(err, util.ErrUserNotFound) {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		if errors.Is(err, util.ErrNoUsernameOrPasswordProvided) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		if errors.Is(err, util.ErrInvalidUsernameOrPassword) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -66,22 +54,17 @@ func (s AuthControllerImpl) Authenticate(ctx *gin.Context) {
 
 // Register creates a new user. It needs the following fields to
 // be set: username, email and password.
-// optional: Name and role
+// optional: Name and role (only user)
 // It returns a token used for auth.
 func (s AuthControllerImpl) Register(ctx *gin.Context) {
 	var registerReq request.Register
-	if err := ctx.ShouldBindJSON(&registerReq); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(ctx, &registerReq) {
 		return
 	}
 
 	token, err := s.service.Register(ctx, registerReq)
 	if err != nil {
-		if errors.Is(err, util.ErrUserAlreadyExists) {
-			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -91,19 +74,32 @@ func (s AuthControllerImpl) Register(ctx *gin.Context) {
 func (s AuthControllerImpl) Logout(ctx *gin.Context) {
 	token := ctx.GetHeader("Token")
 	if token == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "missing token"})
+		ctx.Error(util.ErrMissingToken)
 		return
 	}
 
 	err := s.service.Logout(ctx, token)
 	if err != nil {
-		if errors.Is(err, util.ErrNoValidTokenProvided) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(util.TokenError(err))
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{})
 }
+
+// Restore brings back a deleted account while it's still in its grace period.
+// It needs the username and password of the account and returns a new token
+func (s AuthControllerImpl) Restore(ctx *gin.Context) {
+	var restoreReq request.Auth
+	if !bindJSON(ctx, &restoreReq) {
+		return
+	}
+
+	token, err := s.service.Restore(ctx, restoreReq)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"token": token})
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// bindJSON binds the body to req and checks its validation rules before it
+// reaches the services. On failure the error is added to ctx and it's false
+func bindJSON(ctx *gin.Context, req any) bool {
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.Error(bindError(err))
+		return false
+	}
+	return true
+}
+
+// bindError turns a binding error into a validation error listing the fields,
+// a too large error when the body went past its limit, or an invalid body
+// error when the body couldn't be read
+func bindError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return util.ErrRequestBodyTooLarge.WithDetail("limit", tooLarge.Limit)
+	}
+	if fields, ok := request.FieldErrors(err); ok {
+		return util.ErrValidation.WithDetail("fields", fields)
+	}
+	return util.ErrInvalidRequestBody
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/health"
+)
+
+type HealthController interface {
+	Liveness(ctx *gin.Context)
+	Readiness(ctx *gin.Context)
+}
+
+type HealthControllerImpl struct {
+	registry *health.Registry
+}
+
+func HealthControllerInit(registry *health.Registry) *HealthControllerImpl {
+	return &HealthControllerImpl{registry: registry}
+}
+
+// Liveness reports that the process is up and serving requests. It doesn't
+// check the dependencies, restarting the app wouldn't fix them
+func (s HealthControllerImpl) Liveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Readiness reports if the app can serve requests: every dependency check is
+// ok and it's not shutting down. Returns 503 with the report otherwise
+func (s HealthControllerImpl) Readiness(ctx *gin.Context) {
+	report := s.registry.Check(ctx)
+	if report.Status != health.StatusOK {
+		ctx.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type RewardController interface {
+	GetRewards(ctx *gin.Context)
+	GetAllRewards(ctx *gin.Context)
+	GetReward(ctx *gin.Context)
+	CreateReward(ctx *gin.Context)
+	UpdateReward(ctx *gin.Context)
+	DeleteReward(ctx *gin.Context)
+	Redeem(ctx *gin.Context)
+	GetRedemptions(ctx *gin.Context)
+	UpdateRedemptionStatus(ctx *gin.Context)
+}
+
+type RewardControllerImpl struct {
+	service service.RewardService
+}
+
+func RewardControllerInit(service service.RewardService) *RewardControllerImpl {
+	return &RewardControllerImpl{service: service}
+}
+
+// GetRewards returns the rewards that can be redeemed right now
+func (s RewardControllerImpl) GetRewards(ctx *gin.Context) {
+	rewards, err := s.service.GetRewards(ctx, true)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rewards)
+}
+
+// GetAllRewards returns the whole catalog, including rewards out of stock
+// or outside their availability window
+func (s RewardControllerImpl) GetAllRewards(ctx *gin.Context) {
+	rewards, err := s.service.GetRewards(ctx, false)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rewards)
+}
+
+// GetReward returns the reward with the id in the path
+func (s RewardControllerImpl) GetReward(ctx *gin.Context) {
+	reward, err := s.service.GetReward(ctx, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, reward)
+}
+
+// CreateReward adds a reward to the catalog. It needs the following fields to
+// be set: name, cost and stock.
+// optional: description, available_from and available_until
+func (s RewardControllerImpl) CreateReward(ctx *gin.Context) {
+	var rewardReq request.Reward
+	if !bindJSON(ctx, &rewardReq) {
+		return
+	}
+
+	reward, err := s.service.CreateReward(ctx, rewardReq)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, reward)
+}
+
+// UpdateReward replaces the fields of the reward with the id in the path
+func (s RewardControllerImpl) UpdateReward(ctx *gin.Context) {
+	var rewardReq request.Reward
+	if !bindJSON(ctx, &rewardReq) {
+		return
+	}
+
+	err := s.service.UpdateReward(ctx, ctx.Param("id"), rewardReq)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+// DeleteReward removes the reward with the id in the path from the catalog
+func (s RewardControllerImpl) DeleteReward(ctx *gin.Context) {
+	if err := s.service.DeleteReward(ctx, ctx.Param("id")); err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+// Redeem spends the points of the user who owns the token on the reward
+// with the id in the path and returns the pending redemption
+func (s RewardControllerImpl) Redeem(ctx *gin.Context) {
+	token := ctx.GetHeader("Token")
+	if token == "" {
+		ctx.Error(util.ErrMissingToken)
+		return
+	}
+
+	redemption, err := s.service.Redeem(ctx, token, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(util.TokenError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, redemption)
+}
+
+// GetRedemptions returns the redemption history of the user who owns the token
+func (s RewardControllerImpl) GetRedemptions(ctx *gin.Context) {
+	token := ctx.GetHeader("Token")
+	if token == "" {
+		ctx.Error(util.ErrMissingToken)
+		return
+	}
+
+	redemptions, err := s.service.GetRedemptions(ctx, token)
+	if err != nil {
+		ctx.Error(util.TokenError(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, redemptions)
+}
+
+// UpdateRedemptionStatus marks the redemption with the id in the path as
+// fulfilled or cancelled. Cancelled redemptions are refunded
+func (s RewardControllerImpl) UpdateRedemptionStatus(ctx *gin.Context) {
+	var statusReq request.RedemptionStatus
+	if !bindJSON(ctx, &statusReq) {
+		return
+	}
+
+	err := s.service.UpdateRedemptionStatus(ctx, ctx.Param("id"), model.RedemptionStatus(statusReq.Status))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
@@ -1,10 +1,16 @@
 package controller
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/event"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+	"ignaciofp.es/web-service-portfolio/model"
 	"ignaciofp.es/web-service-portfolio/model/request"
 	"ignaciofp.es/web-service-portfolio/service"
 	"ignaciofp.es/web-service-portfolio/util"
@@ -13,16 +19,25 @@ import (
 type UserController interface {
 	Ping(ctx *gin.Context)
 	GetUser(ctx *gin.Context)
+	GetProfile(ctx *gin.Context)
 	UpdateUser(ctx *gin.Context)
 	DeleteUser(ctx *gin.Context)
+	AddPoints(ctx *gin.Context)
+	Stream(ctx *gin.Context)
 }
 
+// streamHeartbeat is how often a comment is sent on idle streams so proxies
+// don't close them
+const streamHeartbeat = 15 * time.Second
+
 type UserControllerImpl struct {
-	service service.UserService
+	service  service.UserService
+	feed     event.UserFeed
+	stopping <-chan struct{}
 }
 
-func UserControllerInit(service service.UserService) *UserControllerImpl {
-	return &UserControllerImpl{service: service}
+func UserControllerInit(service service.UserService, feed event.UserFeed, lc *lifecycle.Lifecycle) *UserControllerImpl {
+	return &UserControllerImpl{service: service, feed: feed, stopping: lc.Stopping()}
 }
 
 // Ping just sends a "Hello!" string back to the client
@@ -34,41 +49,53 @@ func (s UserControllerImpl) Ping(ctx *gin.Context) {
 func (s UserControllerImpl) GetUser(ctx *gin.Context) {
 	token := ctx.GetHeader("Token")
 	if token == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "missing token"})
+		ctx.Error(util.ErrMissingToken)
 		return
 	}
 
 	user, err := s.service.GetUserByToken(ctx, token)
 	if err != nil {
-		if errors.Is(err, util.ErrUserNotFound) {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, err.Error())
+		ctx.Error(util.TokenError(err))
 		return
 	}
 	ctx.JSON(http.StatusOK, user)
 }
 
+// GetProfile gets a token and returns the profile of the user associated with
+// the token, the v2 representation of the user
+func (s UserControllerImpl) GetProfile(ctx *gin.Context) {
+	token := ctx.GetHeader("Token")
+	if token == "" {
+		ctx.Error(util.ErrMissingToken)
+		return
+	}
+
+	user, err := s.service.GetUserByToken(ctx, token)
+	if err != nil {
+		ctx.Error(util.TokenError(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, model.NewProfile(user))
+}
+
 // UpdateUser takes a token and updates the user who owns the token
-// The only fields that are allowed to update are "points" and "token"
+// The only field that is allowed to update is "token"
 func (s UserControllerImpl) UpdateUser(ctx *gin.Context) {
 	token := ctx.GetHeader("Token")
+	if token == "" {
+		ctx.Error(util.ErrMissingToken)
+		return
+	}
 
 	// Checking if provided body is valid and binding to update request
 	var updateReq request.Update
-	if err := ctx.ShouldBindJSON(&updateReq); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+	if !bindJSON(ctx, &updateReq) {
 		return
 	}
 
 	err := s.service.UpdateUser(ctx, token, updateReq)
 	if err != nil {
-		if errors.Is(err, util.ErrUserNotFound) {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": util.ErrNoValidTokenProvided})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(util.TokenError(err))
 		return
 	}
 
@@ -78,14 +105,109 @@ func (s UserControllerImpl) UpdateUser(ctx *gin.Context) {
 // DeleteUser deletes the user who the token belongs to
 func (s UserControllerImpl) DeleteUser(ctx *gin.Context) {
 	token := ctx.GetHeader("Token")
+	if token == "" {
+		ctx.Error(util.ErrMissingToken)
+		return
+	}
 
 	if err := s.service.DeleteUser(ctx, token); err != nil {
-		if errors.Is(err, util.ErrUserNotFound) { // Y si no te gusta te jodes
-			ctx.JSON(http.StatusNotFound, gin.H{"error": util.ErrNoValidTokenProvided.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(util.TokenError(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+// AddPoints adds points to the user with the id in the path, or takes them
+// away if negative. Only for admins, users can't change their own balance
+func (s UserControllerImpl) AddPoints(ctx *gin.Context) {
+	var pointsReq request.Points
+	if !bindJSON(ctx, &pointsReq) {
+		return
+	}
+
+	if err := s.service.AddPoints(ctx, ctx.Param("id"), pointsReq.Points); err != nil {
+		ctx.Error(err)
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{})
 }
+
+// Stream pushes the profile and points changes of the user who owns the token
+// as Server-Sent Events. Browsers can't set headers on an EventSource, so the
+// token can also be sent in the token query param. A reconnecting client sends
+// the Last-Event-ID header and gets the updates it missed, or a new snapshot
+// if they are gone
+func (s UserControllerImpl) Stream(ctx *gin.Context) {
+	token := ctx.GetHeader("Token")
+	if token == "" {
+		token = ctx.Query("token")
+	}
+	if token == "" {
+		ctx.Error(util.ErrMissingToken)
+		return
+	}
+
+	user, err := s.service.GetUserByToken(ctx, token)
+	if err != nil {
+		ctx.Error(util.TokenError(err))
+		return
+	}
+
+	// Subscribing before taking the snapshot so no change falls in between
+	reqCtx := ctx.Request.Context()
+	updates, resumed, err := s.feed.Subscribe(reqCtx, user.ID, ctx.GetHeader("Last-Event-ID"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	// Streams outlive the write timeout of the server, dead clients are
+	// noticed when the heartbeat fails
+	_ = http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+	fmt.Fprint(ctx.Writer, "retry: 3000\n\n")
+	if !resumed {
+		writeUserUpdate(ctx.Writer, model.NewUserUpdate("", model.UserSnapshot, user))
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-reqCtx.Done():
+			return
+		case <-s.stopping:
+			// Ending the stream so the server doesn't wait for it when
+			// shutting down, the client reconnects to another instance
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(ctx.Writer, ": heartbeat\n\n")
+		case update, ok := <-updates:
+			if !ok {
+				// The feed dropped the client, it will reconnect and resume
+				return
+			}
+			writeUserUpdate(ctx.Writer, update)
+			if update.Type == model.UserDeletedUpdate {
+				ctx.Writer.Flush()
+				return
+			}
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+// writeUserUpdate writes the update as a Server-Sent Event named after its type
+func writeUserUpdate(w io.Writer, update model.UserUpdate) {
+	data, _ := json.Marshal(update)
+	if update.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", update.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", update.Type, data)
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type WebhookController interface {
+	GetSubscriptions(ctx *gin.Context)
+	GetSubscription(ctx *gin.Context)
+	CreateSubscription(ctx *gin.Context)
+	UpdateSubscription(ctx *gin.Context)
+	DeleteSubscription(ctx *gin.Context)
+	GetDeliveries(ctx *gin.Context)
+	ReplayDelivery(ctx *gin.Context)
+}
+
+type WebhookControllerImpl struct {
+	service service.WebhookService
+}
+
+func WebhookControllerInit(service service.WebhookService) *WebhookControllerImpl {
+	return &WebhookControllerImpl{service: service}
+}
+
+// GetSubscriptions returns every webhook subscription
+func (s WebhookControllerImpl) GetSubscriptions(ctx *gin.Context) {
+	subscriptions, err := s.service.GetSubscriptions(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, subscriptions)
+}
+
+// GetSubscription returns the subscription with the id in the path
+func (s WebhookControllerImpl) GetSubscription(ctx *gin.Context) {
+	subscription, err := s.service.GetSubscription(ctx, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+// CreateSubscription subscribes a url to domain events. It needs the following
+// fields to be set: url and event_types.
+// optional: secret (generated if missing) and active (true by default)
+func (s WebhookControllerImpl) CreateSubscription(ctx *gin.Context) {
+	var subscriptionReq request.WebhookSubscription
+	if !bindJSON(ctx, &subscriptionReq) {
+		return
+	}
+
+	subscription, err := s.service.CreateSubscription(ctx, subscriptionReq)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, subscription)
+}
+
+// UpdateSubscription replaces the url and event types of the subscription with
+// the id in the path. The secret is rotated if given
+func (s WebhookControllerImpl) UpdateSubscription(ctx *gin.Context) {
+	var subscriptionReq request.WebhookSubscription
+	if !bindJSON(ctx, &subscriptionReq) {
+		return
+	}
+
+	err := s.service.UpdateSubscription(ctx, ctx.Param("id"), subscriptionReq)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+// DeleteSubscription removes the subscription with the id in the path
+func (s WebhookControllerImpl) DeleteSubscription(ctx *gin.Context) {
+	if err := s.service.DeleteSubscription(ctx, ctx.Param("id")); err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+// GetDeliveries returns a page of the delivery log of the subscription with the
+// id in the path, newest first. Accepted query params: status, page and per_page
+func (s WebhookControllerImpl) GetDeliveries(ctx *gin.Context) {
+	page, err := strconv.ParseInt(ctx.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || page < 1 {
+		ctx.Error(util.ErrInvalidQueryParam.WithDetail("param", "page"))
+		return
+	}
+	perPage, err := strconv.ParseInt(ctx.DefaultQuery("per_page", "50"), 10, 64)
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		ctx.Error(util.ErrInvalidQueryParam.WithMessage("invalid per_page, must be between 1 and 100").WithDetail("param", "per_page"))
+		return
+	}
+
+	query := repository.WebhookDeliveryQuery{
+		SubscriptionID: ctx.Param("id"),
+		Status:         model.WebhookDeliveryStatus(ctx.Query("status")),
+		Offset:         (page - 1) * perPage,
+		Limit:          perPage,
+	}
+	deliveries, total, err := s.service.GetDeliveries(ctx, query)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"page":       page,
+		"per_page":   perPage,
+		"total":      total,
+	})
+}
+
+// ReplayDelivery sends the delivery with the id in the path again
+func (s WebhookControllerImpl) ReplayDelivery(ctx *gin.Context) {
+	if err := s.service.ReplayDelivery(ctx, ctx.Param("id"), ctx.Param("delivery")); err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{})
+}
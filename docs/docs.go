@@ -0,0 +1,132 @@
+// Package docs serves the OpenAPI document of the API and its docs UI.
+package docs
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+//go:generate sh fetch-swagger-ui.sh 5.17.14
+
+// Spec is the OpenAPI 3.1 document of the API. It's written by hand, so every
+// route added to the router must be described in openapi.json too
+//
+//go:embed openapi.json
+var Spec []byte
+
+// ui loads Swagger UI pointed at the document
+//
+//go:embed index.html
+var ui []byte
+
+// assets are the scripts and styles of Swagger UI, served by the app so the
+// docs load nothing from third parties. swagger-ui.css and
+// swagger-ui-bundle.js are vendored by fetch-swagger-ui.sh
+//
+//go:embed swagger-ui
+var assets embed.FS
+
+// methods are the operations of a path item, other keys like parameters
+// are not routes
+var methods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// SpecHandler serves the document
+func SpecHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "application/json", Spec)
+	}
+}
+
+// uiPolicy is the Content-Security-Policy of the docs UI, which only loads
+// the assets served by the app. Swagger UI sets inline styles on its elements
+const uiPolicy = "default-src 'none'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'"
+
+// UIHandler serves the docs UI, which reads the document from /openapi.json
+func UIHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Content-Security-Policy", uiPolicy)
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", ui)
+	}
+}
+
+// AssetHandler serves the Swagger UI asset named by the file path param. Only
+// scripts and styles are served
+func AssetHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		file := ctx.Param("file")
+		ext := path.Ext(file)
+		if ext != ".js" && ext != ".css" {
+			ctx.Error(util.ErrRouteNotFound)
+			return
+		}
+		data, err := assets.ReadFile("swagger-ui/" + file)
+		if err != nil {
+			ctx.Error(util.ErrRouteNotFound)
+			return
+		}
+		ctx.Data(http.StatusOK, mime.TypeByExtension(ext), data)
+	}
+}
+
+// Coverage compares the routes of the router with the operations of the
+// document. missing are the routes the document doesn't describe and unrouted
+// the operations no route serves, both as "METHOD /path" in OpenAPI syntax
+func Coverage(routes gin.RoutesInfo) (missing []string, unrouted []string, err error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(Spec, &doc); err != nil {
+		return nil, nil, fmt.Errorf("reading openapi.json: %w", err)
+	}
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if methods[method] {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	routed := map[string]bool{}
+	for _, route := range routes {
+		operation := route.Method + " " + openAPIPath(route.Path)
+		routed[operation] = true
+		if !documented[operation] {
+			missing = append(missing, operation)
+		}
+	}
+	for operation := range documented {
+		if !routed[operation] {
+			unrouted = append(unrouted, operation)
+		}
+	}
+
+	sort.Strings(missing)
+	sort.Strings(unrouted)
+	return missing, unrouted, nil
+}
+
+// openAPIPath turns a gin path like /rewards/:id into /rewards/{id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,5 @@
+// Starts Swagger UI pointed at the document. It's a file of its own so the
+// docs page runs no inline script
+window.onload = () => {
+  window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+};
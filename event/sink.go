@@ -0,0 +1,31 @@
+// Package event holds the sinks domain events are delivered to.
+package event
+
+import (
+	"context"
+
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/model"
+)
+
+// Sink receives the domain events. Delivery is at least once: a sink may get
+// the same event more than once and must tell duplicates apart by event id
+type Sink interface {
+	// Name identifies the sink in the delivery state of the events, it
+	// must not change between restarts
+	Name() string
+	Deliver(ctx context.Context, event model.DomainEvent) error
+}
+
+// LogSink writes every event to the log, useful for local development
+type LogSink struct{}
+
+func (LogSink) Name() string {
+	return "log"
+}
+
+// Deliver logs the event
+func (LogSink) Deliver(ctx context.Context, event model.DomainEvent) error {
+	logging.FromContext(ctx).Info("Domain event", "event", event)
+	return nil
+}
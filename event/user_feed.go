@@ -0,0 +1,178 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+const (
+	// broadcastHistory is how many updates are kept to resume streams
+	broadcastHistory = 1024
+	// subscriberBuffer is how many updates a slow subscriber may fall behind
+	// before it's disconnected. It can resume with the id of its last update
+	subscriberBuffer = 16
+)
+
+// UserFeed streams the changes of a user
+type UserFeed interface {
+	// Subscribe returns the updates of the user until ctx is done or the channel
+	// is closed. If lastEventID is given the updates after it are sent first and
+	// resumed reports if that was possible, otherwise some updates were missed
+	Subscribe(ctx context.Context, userID string, lastEventID string) (updates <-chan model.UserUpdate, resumed bool, err error)
+}
+
+// UserBroadcaster is an in-process UserFeed fed by the domain events as a sink.
+// It only sees the changes dispatched by this process, use it when the
+// database can't stream changes
+type UserBroadcaster struct {
+	users repository.UserRepository
+
+	mu          *sync.Mutex
+	boot        string
+	seq         uint64
+	history     []model.UserUpdate
+	subscribers map[string]map[chan model.UserUpdate]struct{}
+}
+
+func UserBroadcasterInit(users repository.UserRepository) *UserBroadcaster {
+	return &UserBroadcaster{
+		users:       users,
+		mu:          &sync.Mutex{},
+		boot:        primitive.NewObjectID().Hex(),
+		subscribers: map[string]map[chan model.UserUpdate]struct{}{},
+	}
+}
+
+func (b *UserBroadcaster) Name() string {
+	return "stream"
+}
+
+// Deliver turns points changes and deletions into updates of the user
+func (b *UserBroadcaster) Deliver(ctx context.Context, event model.DomainEvent) error {
+	var update model.UserUpdate
+	switch event.Type {
+	case model.PointsChanged:
+		user, err := b.users.FindByID(ctx, event.UserID)
+		if errors.Is(err, util.ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		update = model.NewUserUpdate("", model.UserPointsUpdate, user)
+	case model.UserDeleted:
+		update = model.NewUserUpdate("", model.UserDeletedUpdate, model.User{ID: event.UserID})
+	default:
+		return nil
+	}
+
+	b.publish(update)
+	return nil
+}
+
+// Subscribe returns the updates of the user. Ids of a previous run of the
+// process can't be resumed
+func (b *UserBroadcaster) Subscribe(ctx context.Context, userID string, lastEventID string) (<-chan model.UserUpdate, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	updates := make(chan model.UserUpdate, subscriberBuffer)
+	resumed := false
+	if seq, ok := b.parseID(lastEventID); ok && b.canResumeFrom(seq) {
+		var missed []model.UserUpdate
+		for _, update := range b.history {
+			if update.User.ID == userID && b.seqOf(update) > seq {
+				missed = append(missed, update)
+			}
+		}
+
+		// Too far behind, the client is better off with a new snapshot
+		if len(missed) <= cap(updates) {
+			resumed = true
+			for _, update := range missed {
+				updates <- update
+			}
+		}
+	}
+
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = map[chan model.UserUpdate]struct{}{}
+	}
+	b.subscribers[userID][updates] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.unsubscribe(userID, updates)
+	}()
+	return updates, resumed, nil
+}
+
+// publish numbers the update, keeps it in the history and sends it to the
+// subscribers of its user
+func (b *UserBroadcaster) publish(update model.UserUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	update.ID = fmt.Sprintf("%s-%d", b.boot, b.seq)
+	b.history = append(b.history, update)
+	if len(b.history) > broadcastHistory {
+		b.history = b.history[len(b.history)-broadcastHistory:]
+	}
+
+	for subscriber := range b.subscribers[update.User.ID] {
+		select {
+		case subscriber <- update:
+		default:
+			b.unsubscribe(update.User.ID, subscriber)
+		}
+	}
+}
+
+// unsubscribe removes and closes the subscriber. The caller must hold the lock
+func (b *UserBroadcaster) unsubscribe(userID string, subscriber chan model.UserUpdate) {
+	if _, ok := b.subscribers[userID][subscriber]; !ok {
+		return
+	}
+	delete(b.subscribers[userID], subscriber)
+	if len(b.subscribers[userID]) == 0 {
+		delete(b.subscribers, userID)
+	}
+	close(subscriber)
+}
+
+// canResumeFrom reports if every update after seq is still in the history.
+// The caller must hold the lock
+func (b *UserBroadcaster) canResumeFrom(seq uint64) bool {
+	if seq > b.seq {
+		return false
+	}
+	return len(b.history) == 0 || b.seqOf(b.history[0]) <= seq+1
+}
+
+// parseID returns the sequence of an update id of this process
+func (b *UserBroadcaster) parseID(id string) (uint64, bool) {
+	boot, seq, found := strings.Cut(id, "-")
+	if !found || boot != b.boot {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// seqOf returns the sequence of an update published by this broadcaster
+func (b *UserBroadcaster) seqOf(update model.UserUpdate) uint64 {
+	seq, _ := b.parseID(update.ID)
+	return seq
+}
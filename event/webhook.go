@@ -0,0 +1,101 @@
+package event
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+)
+
+// Headers sent with every webhook. The signature covers the timestamp and the
+// body, so receivers can reject replayed requests with an old timestamp
+const (
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// WebhookSink queues a delivery of every event for each active subscription
+// that wants it. The deliveries are sent by the webhook sender
+type WebhookSink struct {
+	repository repository.WebhookRepository
+}
+
+func WebhookSinkInit(repository repository.WebhookRepository) *WebhookSink {
+	return &WebhookSink{repository: repository}
+}
+
+func (s WebhookSink) Name() string {
+	return "webhooks"
+}
+
+// Deliver queues the event for the subscriptions that want it. Queuing the
+// same event twice is a no-op, so it's safe for the dispatcher to retry
+func (s WebhookSink) Deliver(ctx context.Context, event model.DomainEvent) error {
+	subscriptions, err := s.repository.FindSubscriptionsFor(ctx, event.Type)
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]model.WebhookDelivery, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		deliveries = append(deliveries, model.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        string(payload),
+			Status:         model.WebhookDeliveryPending,
+			Attempts:       []model.WebhookAttempt{},
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+	return s.repository.CreateDeliveries(ctx, deliveries...)
+}
+
+// SignWebhook returns the signature header of the payload sent at the given
+// time: "sha256=" followed by the hex HMAC-SHA256 of "<unix timestamp>.<payload>"
+func SignWebhook(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the timestamp and signature headers of a received webhook.
+// Requests older than tolerance are rejected to prevent replays
+func VerifyWebhook(secret string, timestampHeader string, signatureHeader string, payload []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+
+	timestamp := time.Unix(unix, 0)
+	if age := time.Since(timestamp); age > tolerance || age < -tolerance {
+		return ErrInvalidWebhookSignature
+	}
+
+	expected := SignWebhook(secret, timestamp, payload)
+	if !hmac.Equal([]byte(expected), []byte(strings.TrimSpace(signatureHeader))) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Package health checks the dependencies the app needs to serve requests.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+)
+
+const (
+	// checkTimeout is how long a single check may take before it fails
+	checkTimeout = 2 * time.Second
+	// cacheTTL is how long a report is reused, so frequent probes don't
+	// hammer the dependencies
+	cacheTTL = 2 * time.Second
+	// unavailable is the error reported for a failing check. The report is
+	// public, the actual error is only logged
+	unavailable = "unavailable"
+)
+
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusFailing  Status = "failing"
+	StatusStopping Status = "stopping"
+)
+
+// Check reports if a dependency works, it must give up once ctx is done
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status    Status  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check. The app is ready if every check is ok
+type Report struct {
+	Status    Status                 `json:"status"`
+	Checks    map[string]CheckResult `json:"checks"`
+	CheckedAt time.Time              `json:"checked_at"`
+}
+
+// Registry runs the checks components register. Readiness fails once the app
+// starts stopping so load balancers take the instance out before it closes
+type Registry struct {
+	mu       *sync.Mutex
+	checks   map[string]Check
+	stopping <-chan struct{}
+	cached   Report
+}
+
+func RegistryInit(lc *lifecycle.Lifecycle) *Registry {
+	return &Registry{mu: &sync.Mutex{}, checks: map[string]Check{}, stopping: lc.Stopping()}
+}
+
+// Register adds a check, replacing any other with the same name
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+	r.cached = Report{}
+}
+
+// Check runs every check in parallel, or returns the last report if it's
+// recent enough
+func (r *Registry) Check(ctx context.Context) Report {
+	select {
+	case <-r.stopping:
+		return Report{Status: StatusStopping, Checks: map[string]CheckResult{}, CheckedAt: time.Now().UTC()}
+	default:
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.cached.CheckedAt.IsZero() && time.Since(r.cached.CheckedAt) < cacheTTL {
+		return r.cached
+	}
+
+	report := Report{Status: StatusOK, Checks: map[string]CheckResult{}, CheckedAt: time.Now().UTC()}
+	// The report is shared, a probe giving up must not fail it for the others
+	ctx = context.WithoutCancel(ctx)
+	results := make(chan namedResult, len(r.checks))
+	for name, check := range r.checks {
+		go func(name string, check Check) {
+			results <- namedResult{name, run(ctx, name, check)}
+		}(name, check)
+	}
+	for range r.checks {
+		res := <-results
+		report.Checks[res.name] = res.result
+		if res.result.Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+
+	r.cached = report
+	return report
+}
+
+type namedResult struct {
+	name   string
+	result CheckResult
+}
+
+// run runs the check with the timeout and measures it. The error of a failing
+// check is logged, not reported
+func run(ctx context.Context, name string, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := CheckResult{Status: StatusOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = unavailable
+		slog.WarnContext(ctx, "Health check failed", "check", name, "error", err)
+	}
+	return result
+}
@@ -0,0 +1,29 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ignaciofp.es/web-service-portfolio/health"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+)
+
+func TestCheckHidesTheError(t *testing.T) {
+	registry := health.RegistryInit(lifecycle.LifecycleInit())
+	registry.Register("ok", func(ctx context.Context) error { return nil })
+	registry.Register("mongo", func(ctx context.Context) error {
+		return errors.New("connection() error occurred during connection handshake: auth error: user admin@10.0.0.5")
+	})
+
+	report := registry.Check(context.Background())
+	if report.Status != health.StatusFailing {
+		t.Errorf("report status = %s, want %s", report.Status, health.StatusFailing)
+	}
+	if result := report.Checks["ok"]; result.Status != health.StatusOK || result.Error != "" {
+		t.Errorf("ok check = %+v, want ok without error", result)
+	}
+	if result := report.Checks["mongo"]; result.Status != health.StatusFailing || result.Error != "unavailable" {
+		t.Errorf("mongo check = %+v, want failing with the generic error", result)
+	}
+}
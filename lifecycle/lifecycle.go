@@ -0,0 +1,159 @@
+// Package lifecycle starts and stops the components of the app in order.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"ignaciofp.es/web-service-portfolio/logging"
+)
+
+// Hook is a component that has to be started or stopped with the app. Either
+// function may be nil
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Lifecycle runs the start hooks in the order they were appended and the stop
+// hooks in reverse order, so a component is stopped before the ones it uses
+type Lifecycle struct {
+	mu       *sync.Mutex
+	hooks    []Hook
+	started  int
+	stopping chan struct{}
+}
+
+func LifecycleInit() *Lifecycle {
+	return &Lifecycle{mu: &sync.Mutex{}, stopping: make(chan struct{})}
+}
+
+// Append registers a hook. Hooks appended after Start are not started
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start runs the start hooks in order. If one fails the hooks already started
+// are stopped and the error is returned
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	hooks := l.hooks
+	l.mu.Unlock()
+
+	for _, hook := range hooks {
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				return errors.Join(fmt.Errorf("starting %s: %w", hook.Name, err), l.Stop(ctx))
+			}
+		}
+		l.mu.Lock()
+		l.started++
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop runs the stop hooks of the started components in reverse order. Every
+// hook is run even if others fail or ctx is done, so each one must give up
+// once ctx is done. The errors are joined
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	select {
+	case <-l.stopping:
+	default:
+		close(l.stopping)
+	}
+	hooks := l.hooks[:l.started]
+	l.started = 0
+	l.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+		if hook.OnStop == nil {
+			continue
+		}
+		slog.Info("Stopping", "hook", hook.Name)
+		if err := hook.OnStop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stopping is closed when Stop is called. Long running requests, like streams,
+// use it to end before the server waits for them to finish
+func (l *Lifecycle) Stopping() <-chan struct{} {
+	return l.stopping
+}
+
+// Worker returns the hook of a background loop that runs until its context is
+// done. Stopping it cancels that context and waits for run to return. The
+// context carries a logger that names the worker
+func Worker(name string, run func(ctx context.Context)) Hook {
+	var cancel context.CancelFunc
+	done := make(chan struct{})
+
+	return Hook{
+		Name: name,
+		OnStart: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			ctx = logging.WithLogger(ctx, slog.Default().With("worker", name))
+			go func() {
+				defer close(done)
+				run(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// Server returns the hook of the http server called name. Starting it binds the address so
+// a port in use fails the start, stopping it lets the requests in flight end.
+// Servers with a TLS config serve HTTPS with the certificates it gets.
+// Unexpected serving errors are sent to errs
+func Server(name string, server *http.Server, errs chan<- error) Hook {
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				return err
+			}
+			slog.Info("Listening", "server", name, "addr", listener.Addr().String(), "tls", server.TLSConfig != nil)
+			go func() {
+				var err error
+				if server.TLSConfig != nil {
+					err = server.ServeTLS(listener, "", "")
+				} else {
+					err = server.Serve(listener)
+				}
+				if !errors.Is(err, http.ErrServerClosed) {
+					errs <- err
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return server.Shutdown(ctx)
+		},
+	}
+}
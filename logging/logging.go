@@ -0,0 +1,143 @@
+// Package logging writes the structured logs of the app with log/slog.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive keys
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are the parts of a key, compared in lowercase, that mark its
+// value as a secret that must not reach the logs
+var sensitiveKeys = []string{"token", "password", "authorization", "secret"}
+
+type contextKey struct{}
+
+// New returns a logger writing JSON lines to w from the given level on. Values
+// of sensitive keys are redacted, also inside logged structs, maps and slices
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}))
+}
+
+// WithLogger returns a copy of ctx carrying the logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of ctx, which carries the request id in
+// requests, or the default logger if it has none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Fatal logs the message as an error and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// IsSensitive reports if the values of the key are secrets
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactQuery returns the query string with the values of sensitive params
+// redacted, like the token streams accept in the query
+func RedactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Redacted
+	}
+	for key, values := range query {
+		if IsSensitive(key) {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+	return query.Encode()
+}
+
+// redactAttr is the ReplaceAttr of the handler. Groups are walked by slog, so
+// only the attr itself and the data it holds are checked
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	if IsSensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	if attr.Value.Kind() == slog.KindAny {
+		if redacted, ok := redactData(attr.Value.Any()); ok {
+			return slog.Any(attr.Key, redacted)
+		}
+	}
+	return attr
+}
+
+// redactData returns a copy of structs, maps and slices with the values of
+// their sensitive keys redacted, as they would be encoded in JSON. Other
+// values are left alone
+func redactData(value any) (any, bool) {
+	if _, ok := value.(error); ok {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return nil, false
+	}
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	var data any
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, false
+	}
+	return redactJSON(data), true
+}
+
+// redactJSON redacts the sensitive keys of decoded JSON
+func redactJSON(data any) any {
+	switch d := data.(type) {
+	case map[string]any:
+		for key, value := range d {
+			if IsSensitive(key) {
+				d[key] = Redacted
+				continue
+			}
+			d[key] = redactJSON(value)
+		}
+	case []any:
+		for i, value := range d {
+			d[i] = redactJSON(value)
+		}
+	}
+	return data
+}
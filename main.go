@@ -1,32 +1,104 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	"ignaciofp.es/web-service-portfolio/config"
+	"ignaciofp.es/web-service-portfolio/lifecycle"
+	"ignaciofp.es/web-service-portfolio/logging"
 	"ignaciofp.es/web-service-portfolio/router"
 )
 
-func init() {
-	err := godotenv.Load(".env")
+func main() {
+	// Logging JSON lines from the start, the configured level is known
+	// once the config is loaded
+	slog.SetDefault(logging.New(os.Stdout, slog.LevelInfo))
+
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatalf("Error loading .env file: %s", err)
+		logging.Fatal("Invalid configuration", "errors", strings.Split(err.Error(), "\n"))
 	}
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel))
+	gin.SetMode(cfg.Mode)
 
-	mode := os.Getenv("MODE")
-	gin.SetMode(mode)
-}
+	// Subcommands don't start the server
+	if len(args) > 0 && args[0] == "migrate" {
+		migrate(cfg, args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "openapi" {
+		openapi(cfg, args[1:])
+		return
+	}
 
-func main() {
 	// Initializing dependency injection
-	var init *config.Initialization = config.Init()
+	var init *config.Initialization = config.Init(cfg)
+	lc := init.Lifecycle
+	serverErrs := make(chan error, 2)
+
+	// Serving the metrics on the internal port. Appended first so it's the
+	// last to stop and the shutdown can still be scraped
+	lc.Append(lifecycle.Server("metrics server", config.NewMetricsServer(cfg, init.Metrics.Handler()), serverErrs))
+
+	// Purging deleted accounts once their grace period is over
+	lc.Append(lifecycle.Worker("purger", init.Purger.Run))
 
-	// Init gin and it's mappings
+	// Delivering the domain events in the outbox
+	lc.Append(lifecycle.Worker("event dispatcher", init.Dispatcher.Run))
+
+	// Sending the webhooks queued for the subscriptions
+	lc.Append(lifecycle.Worker("webhook sender", init.WebhookSender.Run))
+
+	// Init gin and it's mappings. The server is appended last so it's the
+	// first to stop and no request reaches a stopped component
 	var app *gin.Engine = router.Init(init)
+	lc.Append(lifecycle.Server("http server", config.NewServer(cfg, router.Handler(app), init.TLS), serverErrs))
+
+	// Readiness fails as soon as the app starts stopping. Waiting before the
+	// server stops gives load balancers time to notice
+	lc.Append(lifecycle.Hook{
+		Name: "readiness drain",
+		OnStop: func(ctx context.Context) error {
+			select {
+			case <-time.After(cfg.ShutdownDelay):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
 
-	port := os.Getenv("PORT")
-	app.Run(":" + port)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := lc.Start(ctx); err != nil {
+		logging.Fatal("Error starting the app", "error", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	case err := <-serverErrs:
+		slog.Error("Error serving requests, shutting down", "error", err)
+	}
+	stop()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := lc.Stop(stopCtx); err != nil {
+		logging.Fatal("Error shutting down", "error", err)
+	}
+	slog.Info("Stopped")
 }
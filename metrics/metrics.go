@@ -0,0 +1,200 @@
+// Package metrics exposes the Prometheus metrics of the app.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	mongoevent "go.mongodb.org/mongo-driver/event"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// Metrics holds every collector of the app in its own registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+	deprecated   *prometheus.CounterVec
+
+	logins        *prometheus.CounterVec
+	registrations *prometheus.CounterVec
+	logouts       *prometheus.CounterVec
+	passwordHash  *prometheus.HistogramVec
+
+	mongoDuration *prometheus.HistogramVec
+	mongoErrors   *prometheus.CounterVec
+	// mongoCollections maps the request id of the commands in flight to
+	// their collection, only the started event carries it
+	mongoCollections *sync.Map
+}
+
+func MetricsInit() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route template.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being served.",
+		}),
+		deprecated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_deprecated_requests_total",
+			Help: "Requests to deprecated routes by method and route template.",
+		}, []string{"method", "route"}),
+
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_logins_total",
+			Help: "Login attempts by method, outcome and failure reason.",
+		}, []string{"method", "outcome", "reason"}),
+		registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_registrations_total",
+			Help: "Registrations by outcome and failure reason.",
+		}, []string{"outcome", "reason"}),
+		logouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_logouts_total",
+			Help: "Logouts by outcome and failure reason.",
+		}, []string{"outcome", "reason"}),
+		passwordHash: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "auth_password_hash_duration_seconds",
+			Help:    "Time spent hashing and comparing passwords with bcrypt.",
+			Buckets: []float64{.1, .25, .5, 1, 2, 4, 8},
+		}, []string{"operation"}),
+
+		mongoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mongo_command_duration_seconds",
+			Help:    "MongoDB command latency by command and collection.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"command", "collection"}),
+		mongoErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mongo_command_errors_total",
+			Help: "Failed MongoDB commands by command and collection.",
+		}, []string{"command", "collection"}),
+		mongoCollections: &sync.Map{},
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration, m.httpInFlight, m.deprecated,
+		m.logins, m.registrations, m.logouts, m.passwordHash,
+		m.mongoDuration, m.mongoErrors,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the rate, errors and duration of the requests by route
+// template, so /rewards/:id is a single series whatever the id
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		m.httpInFlight.Inc()
+		start := time.Now()
+
+		ctx.Next()
+
+		m.httpInFlight.Dec()
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ctx.Request.Method
+		m.httpRequests.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+		m.httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveDeprecated counts a request to a deprecated route
+func (m *Metrics) ObserveDeprecated(method string, route string) {
+	m.deprecated.WithLabelValues(method, route).Inc()
+}
+
+// ObserveLogin counts a login with the given method, "password" or "token"
+func (m *Metrics) ObserveLogin(method string, err error) {
+	outcome, reason := authOutcome(err)
+	m.logins.WithLabelValues(method, outcome, reason).Inc()
+}
+
+// ObserveRegistration counts a registration
+func (m *Metrics) ObserveRegistration(err error) {
+	m.registrations.WithLabelValues(authOutcome(err)).Inc()
+}
+
+// ObserveLogout counts a logout
+func (m *Metrics) ObserveLogout(err error) {
+	m.logouts.WithLabelValues(authOutcome(err)).Inc()
+}
+
+// ObservePasswordHash records how long a bcrypt operation, "hash" or
+// "compare", took
+func (m *Metrics) ObservePasswordHash(operation string, duration time.Duration) {
+	m.passwordHash.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// CommandMonitor returns the mongo driver monitor that records the latency
+// and errors of every command
+func (m *Metrics) CommandMonitor() *mongoevent.CommandMonitor {
+	return &mongoevent.CommandMonitor{
+		Started: func(_ context.Context, e *mongoevent.CommandStartedEvent) {
+			collection, _ := e.Command.Lookup(e.CommandName).StringValueOK()
+			m.mongoCollections.Store(e.RequestID, collection)
+		},
+		Succeeded: func(_ context.Context, e *mongoevent.CommandSucceededEvent) {
+			collection := m.commandCollection(e.RequestID)
+			m.mongoDuration.WithLabelValues(e.CommandName, collection).Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *mongoevent.CommandFailedEvent) {
+			collection := m.commandCollection(e.RequestID)
+			m.mongoDuration.WithLabelValues(e.CommandName, collection).Observe(e.Duration.Seconds())
+			m.mongoErrors.WithLabelValues(e.CommandName, collection).Inc()
+		},
+	}
+}
+
+// commandCollection returns and forgets the collection of the command
+func (m *Metrics) commandCollection(requestID int64) string {
+	collection, _ := m.mongoCollections.LoadAndDelete(requestID)
+	name, _ := collection.(string)
+	return name
+}
+
+// authOutcome turns the error of an auth operation into its outcome and a
+// reason label with a bounded set of values. Unknown usernames come as
+// invalid_password, they aren't told apart from wrong passwords
+func authOutcome(err error) (string, string) {
+	switch {
+	case err == nil:
+		return "success", ""
+	case errors.Is(err, util.ErrNoUsernameOrPasswordProvided):
+		return "failure", "missing_credentials"
+	case errors.Is(err, util.ErrInvalidUsernameOrPassword):
+		return "failure", "invalid_password"
+	case errors.Is(err, util.ErrUserNotFound):
+		return "failure", "invalid_token"
+	case errors.Is(err, util.ErrUserAlreadyExists):
+		return "failure", "already_exists"
+	default:
+		return "failure", "error"
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type AuthMiddleware interface {
+	RequireRole(role string) gin.HandlerFunc
+}
+
+type AuthMiddlewareImpl struct {
+	service service.UserService
+}
+
+func AuthMiddlewareInit(service service.UserService) *AuthMiddlewareImpl {
+	return &AuthMiddlewareImpl{service: service}
+}
+
+// RequireRole aborts the request unless the token belongs to a user with
+// the given role. The user is stored in the context under "user"
+func (m AuthMiddlewareImpl) RequireRole(role string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := ctx.GetHeader("Token")
+		if token == "" {
+			abortWithError(ctx, util.ErrMissingToken)
+			return
+		}
+
+		user, err := m.service.GetUserByToken(ctx, token)
+		if err != nil {
+			abortWithError(ctx, util.TokenError(err))
+			return
+		}
+
+		if user.Role != role {
+			abortWithError(ctx, util.ErrForbidden)
+			return
+		}
+
+		ctx.Set("user", user)
+
+		// Actions from now on are performed by this user
+		info := util.GetRequestInfo(ctx.Request.Context())
+		info.ActorID = user.ID
+		ctx.Request = ctx.Request.WithContext(util.WithRequestInfo(ctx.Request.Context(), info))
+
+		ctx.Next()
+	}
+}
+
+// abortWithError stops the request with the error, Errors renders it
+func abortWithError(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	ctx.Abort()
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// CORSPolicy is which cross-origin requests browsers may send
+type CORSPolicy struct {
+	// AllowOrigins are exact origins like https://app.example.com, "*" for
+	// any origin, wildcards like https://*.example.com or regular
+	// expressions starting with ~, like ~http://localhost:[0-9]+, which
+	// must match the whole origin, ignoring case. Empty allows no
+	// cross-origin request
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// exposedHeaders are the response headers of the app scripts in other
+// origins may read
+var exposedHeaders = []string{RequestIDHeader, "Allow", "Deprecation", "Sunset", "Link"}
+
+// originWildcard is what a * of a wildcard origin matches, a part of a host
+const originWildcard = `[a-z0-9-]+(\.[a-z0-9-]+)*`
+
+// corsGroup is the CORS handler of the routes under a path prefix
+type corsGroup struct {
+	prefix  string
+	allowed func(origin string) bool
+	handler gin.HandlerFunc
+}
+
+// CORS applies the policy to every request, or the policy of the group when
+// the path is under one of the prefixes in groups, the longest one winning.
+// It's a single middleware so preflights, which only reach the handlers of
+// the engine, get the policy of their group too. Requests from origins the
+// policy doesn't allow are answered with an origin_not_allowed problem
+func CORS(policy CORSPolicy, groups map[string]CORSPolicy) (gin.HandlerFunc, error) {
+	root, err := newCORSGroup("", policy)
+	if err != nil {
+		return nil, err
+	}
+	var prefixed []corsGroup
+	for prefix, groupPolicy := range groups {
+		group, err := newCORSGroup(prefix, groupPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", prefix, err)
+		}
+		prefixed = append(prefixed, group)
+	}
+
+	return func(ctx *gin.Context) {
+		group := root
+		for _, g := range prefixed {
+			if underPrefix(ctx.Request.URL.Path, g.prefix) && len(g.prefix) > len(group.prefix) {
+				group = g
+			}
+		}
+
+		// Same origin requests may carry the header too, they are not
+		// cross-origin
+		origin := ctx.GetHeader("Origin")
+		host := ctx.Request.Host
+		crossOrigin := origin != "" && origin != "http://"+host && origin != "https://"+host
+		if crossOrigin && !group.allowed(origin) {
+			abortWithError(ctx, util.ErrOriginNotAllowed)
+			return
+		}
+		group.handler(ctx)
+	}, nil
+}
+
+// OriginMatcher returns a func reporting if an origin matches any of the
+// patterns, see CORSPolicy.AllowOrigins
+func OriginMatcher(patterns []string) (func(origin string) bool, error) {
+	anyOrigin := false
+	var exact []string
+	var expressions []*regexp.Regexp
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*":
+			anyOrigin = true
+		case strings.HasPrefix(pattern, "~"):
+			// Anchored so a prefix or suffix of the origin isn't enough, and
+			// case insensitive like the other patterns, origins are lowercased
+			expression, err := regexp.Compile("(?i)^(?:" + pattern[1:] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid origin expression %q: %w", pattern, err)
+			}
+			expressions = append(expressions, expression)
+		case !strings.HasPrefix(pattern, "http://") && !strings.HasPrefix(pattern, "https://"):
+			return nil, fmt.Errorf("invalid origin %q, must start with http:// or https://", pattern)
+		case strings.Contains(pattern, "*"):
+			quoted := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(pattern)), `\*`, originWildcard)
+			expressions = append(expressions, regexp.MustCompile("^"+quoted+"$"))
+		default:
+			exact = append(exact, strings.ToLower(pattern))
+		}
+	}
+
+	return func(origin string) bool {
+		if anyOrigin {
+			return true
+		}
+		origin = strings.ToLower(origin)
+		for _, e := range exact {
+			if origin == e {
+				return true
+			}
+		}
+		for _, expression := range expressions {
+			if expression.MatchString(origin) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// newCORSGroup builds the handler of a policy
+func newCORSGroup(prefix string, policy CORSPolicy) (corsGroup, error) {
+	allowed, err := OriginMatcher(policy.AllowOrigins)
+	if err != nil {
+		return corsGroup{}, err
+	}
+	anyOrigin := false
+	for _, origin := range policy.AllowOrigins {
+		anyOrigin = anyOrigin || origin == "*"
+	}
+	if anyOrigin && policy.AllowCredentials {
+		return corsGroup{}, errors.New("credentials can't be allowed for any origin")
+	}
+
+	config := cors.Config{
+		AllowAllOrigins:  anyOrigin,
+		AllowMethods:     policy.AllowMethods,
+		AllowHeaders:     policy.AllowHeaders,
+		ExposeHeaders:    exposedHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           policy.MaxAge,
+	}
+	if !anyOrigin {
+		config.AllowOriginFunc = allowed
+	}
+	return corsGroup{prefix: prefix, allowed: allowed, handler: cors.New(config)}, nil
+}
+
+// underPrefix reports if the path is the prefix or below it
+func underPrefix(path string, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
@@ -0,0 +1,118 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"ignaciofp.es/web-service-portfolio/middleware"
+)
+
+func TestOriginMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		origins map[string]bool
+	}{
+		{
+			name:    "exact",
+			pattern: "https://app.example.com",
+			origins: map[string]bool{
+				"https://app.example.com":          true,
+				"HTTPS://App.Example.com":          true,
+				"http://app.example.com":           false,
+				"https://app.example.com:8443":     false,
+				"https://app.example.com.evil.com": false,
+				"https://evilapp.example.com":      false,
+				"https://sub.app.example.com":      false,
+			},
+		},
+		{
+			name:    "wildcard",
+			pattern: "https://*.example.com",
+			origins: map[string]bool{
+				"https://app.example.com":          true,
+				"https://a.b.example.com":          true,
+				"https://App.Example.com":          true,
+				"https://example.com":              false,
+				"http://app.example.com":           false,
+				"https://app.example.com.evil.com": false,
+				"https://evil.com/.example.com":    false,
+				"https://evilexample.com":          false,
+			},
+		},
+		{
+			name:    "expression",
+			pattern: `~https://app\.example\.com`,
+			origins: map[string]bool{
+				"https://app.example.com":          true,
+				"https://app.example.com.evil.com": false,
+				"https://evilapp.example.com":      false,
+				"http://https://app.example.com":   false,
+			},
+		},
+		{
+			name:    "expression with uppercase",
+			pattern: `~https://App\.example\.com`,
+			origins: map[string]bool{
+				"https://app.example.com": true,
+				"https://APP.example.com": true,
+			},
+		},
+		{
+			name:    "expression already anchored",
+			pattern: `~^http://localhost:[0-9]+$`,
+			origins: map[string]bool{
+				"http://localhost:3000":          true,
+				"http://localhost:3000.evil.com": false,
+				"http://localhost":               false,
+			},
+		},
+		{
+			name:    "expression with alternatives",
+			pattern: `~https://a\.example\.com|https://b\.example\.com`,
+			origins: map[string]bool{
+				"https://a.example.com":          true,
+				"https://b.example.com":          true,
+				"https://a.example.com.evil.com": false,
+				"https://evil.b.example.com":     false,
+			},
+		},
+		{
+			name:    "any",
+			pattern: "*",
+			origins: map[string]bool{
+				"https://anything.example.org": true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := middleware.OriginMatcher([]string{tt.pattern})
+			if err != nil {
+				t.Fatalf("OriginMatcher(%q) error = %v", tt.pattern, err)
+			}
+			for origin, want := range tt.origins {
+				if got := matches(origin); got != want {
+					t.Errorf("%q matches %q = %v, want %v", tt.pattern, origin, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOriginMatcherInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"app.example.com", "ftp://app.example.com", "~https://(app"} {
+		if _, err := middleware.OriginMatcher([]string{pattern}); err == nil {
+			t.Errorf("OriginMatcher(%q) error = nil, want an error", pattern)
+		}
+	}
+}
+
+func TestOriginMatcherNoPatterns(t *testing.T) {
+	matches, err := middleware.OriginMatcher(nil)
+	if err != nil {
+		t.Fatalf("OriginMatcher error = %v", err)
+	}
+	if matches("https://app.example.com") {
+		t.Errorf("no patterns match an origin, want none allowed")
+	}
+}
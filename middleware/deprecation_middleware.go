@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/metrics"
+)
+
+// DeprecationPolicy is when the legacy routes were deprecated and, if
+// decided, when they stop being served
+type DeprecationPolicy struct {
+	DeprecatedAt time.Time
+	// Sunset is zero while no date has been announced
+	Sunset time.Time
+}
+
+type DeprecationMiddleware interface {
+	Deprecated(successor string) gin.HandlerFunc
+}
+
+type DeprecationMiddlewareImpl struct {
+	policy  DeprecationPolicy
+	metrics *metrics.Metrics
+}
+
+func DeprecationMiddlewareInit(policy DeprecationPolicy, metrics *metrics.Metrics) *DeprecationMiddlewareImpl {
+	return &DeprecationMiddlewareImpl{policy: policy, metrics: metrics}
+}
+
+// Deprecated marks the responses of the routes as deprecated with the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) headers, linking to the same
+// path under the successor prefix, and counts the requests by route so we
+// know who still has to move
+func (m DeprecationMiddlewareImpl) Deprecated(successor string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Deprecation", fmt.Sprintf("@%d", m.policy.DeprecatedAt.Unix()))
+		if !m.policy.Sunset.IsZero() {
+			ctx.Header("Sunset", m.policy.Sunset.UTC().Format(http.TimeFormat))
+		}
+		path := successor + "/" + strings.TrimPrefix(ctx.Request.URL.Path, "/")
+		ctx.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", path))
+
+		m.metrics.ObserveDeprecated(ctx.Request.Method, ctx.FullPath())
+		ctx.Next()
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// ProblemContentType is the content type of the error responses, RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// Problem is the body of every error response, an RFC 7807 problem detail with
+// the code of the error, its details and the id of the request as extensions
+type Problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail"`
+	Instance  string         `json:"instance"`
+	Code      string         `json:"code"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+// Errors renders the last error handlers added with ctx.Error as a problem,
+// unless they already answered. Errors that are not a util.AppError are logged
+// and answered as a generic internal error, so driver messages never reach
+// clients
+func Errors() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if len(ctx.Errors) == 0 || ctx.Writer.Written() {
+			return
+		}
+		renderProblem(ctx, ctx.Errors.Last().Err)
+	}
+}
+
+// renderProblem answers the request with the problem of the error
+func renderProblem(ctx *gin.Context, err error) {
+	appErr := util.AsAppError(err)
+	if appErr.Status >= http.StatusInternalServerError {
+		logging.FromContext(ctx.Request.Context()).Error("Error serving request", "error", err.Error())
+	}
+
+	ctx.Header("Content-Type", ProblemContentType)
+	ctx.AbortWithStatusJSON(appErr.Status, Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(appErr.Status),
+		Status:    appErr.Status,
+		Detail:    appErr.Message,
+		Instance:  ctx.Request.URL.Path,
+		Code:      appErr.Code,
+		Details:   appErr.Details,
+		RequestID: util.GetRequestID(ctx.Request.Context()),
+	})
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// RequestLogger logs a line for every request once it's served, as an error
+// for 5xx answers, a warning for 4xx and info otherwise. Secrets in the query,
+// like the token of the streams, are redacted
+func RequestLogger() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", ctx.Request.Method),
+			slog.String("route", ctx.FullPath()),
+			slog.String("path", ctx.Request.URL.Path),
+			slog.String("query", logging.RedactQuery(ctx.Request.URL.RawQuery)),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(ctx.Writer.Size(), 0)),
+			slog.String("ip", util.ClientIP(ctx.Request.Context())),
+			slog.String("user_agent", ctx.Request.UserAgent()),
+		}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", ctx.Errors.String()))
+		}
+		logging.FromContext(ctx.Request.Context()).LogAttrs(ctx.Request.Context(), level, "Request served", attrs...)
+	}
+}
+
+// Recovery answers an internal error problem to requests whose handler
+// panicked and logs the panic with its stack
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(ctx *gin.Context, recovered any) {
+		logging.FromContext(ctx.Request.Context()).Error("Panic serving request",
+			"panic", recovered,
+			"stack", string(debug.Stack()),
+		)
+		renderProblem(ctx, util.ErrInternal)
+	})
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// MethodNotAllowed is the NoMethod handler of the router. It answers OPTIONS
+// with 204 and the methods of the path in the Allow header, and any other
+// method the path doesn't have with a 405 problem and the same header. CORS
+// preflights never get here, the cors middleware answers them first. routes
+// is read on the first request, once every route is registered
+func MethodNotAllowed(routes func() gin.RoutesInfo) gin.HandlerFunc {
+	allRoutes := sync.OnceValue(routes)
+	return func(ctx *gin.Context) {
+		methods := allowedMethods(allRoutes(), ctx.Request.URL.Path)
+		ctx.Header("Allow", strings.Join(methods, ", "))
+		if ctx.Request.Method == http.MethodOptions {
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		ctx.Error(util.ErrMethodNotAllowed.WithDetail("allowed", methods))
+	}
+}
+
+// allowedMethods returns the sorted methods of the routes matching the path,
+// always including OPTIONS
+func allowedMethods(routes gin.RoutesInfo, path string) []string {
+	allowed := map[string]bool{http.MethodOptions: true}
+	for _, route := range routes {
+		if matchRoute(route.Path, path) {
+			allowed[route.Method] = true
+		}
+	}
+
+	methods := make([]string, 0, len(allowed))
+	for method := range allowed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoute reports if the path is served by the gin route pattern, where
+// :name matches a segment and *name the rest of the path
+func matchRoute(pattern string, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if !strings.HasPrefix(segment, ":") && segment != pathSegments[i] {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") && pathSegments[i] == "" {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
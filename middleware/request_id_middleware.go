@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// RequestIDHeader carries the id of the request in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the ids accepted from clients
+const maxRequestIDLength = 128
+
+// RequestID keeps the X-Request-ID of the request, or generates one, and sends
+// it back. The request context gets the id and a logger that adds it, and the
+// trace id if the request is traced, to every line
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		ctx.Header(RequestIDHeader, id)
+
+		logger := logging.FromContext(ctx.Request.Context()).With("request_id", id)
+		if span := trace.SpanContextFromContext(ctx.Request.Context()); span.HasTraceID() {
+			logger = logger.With("trace_id", span.TraceID().String())
+		}
+
+		reqCtx := util.WithRequestID(ctx.Request.Context(), id)
+		ctx.Request = ctx.Request.WithContext(logging.WithLogger(reqCtx, logger))
+		ctx.Next()
+	}
+}
+
+// validRequestID accepts ids of printable ASCII that fit in a log line
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random id
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
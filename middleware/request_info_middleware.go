@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// RequestInfo stores who is making the request in the request context, so
+// services receiving the gin context can read it with util.GetRequestInfo
+// and util.ClientIP. The client address is resolved with the proxy policy
+func RequestInfo(proxies ProxyPolicy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		info := util.RequestInfo{
+			IP:        proxies.ClientIP(ctx.Request),
+			UserAgent: ctx.Request.UserAgent(),
+		}
+		ctx.Request = ctx.Request.WithContext(util.WithRequestInfo(ctx.Request.Context(), info))
+		ctx.Next()
+	}
+}
+
+// Headers proxies may tell the client address in
+const (
+	ForwardedHeader     = "Forwarded"
+	XForwardedForHeader = "X-Forwarded-For"
+	XRealIPHeader       = "X-Real-IP"
+)
+
+// ProxyPolicy is which proxies in front of the app are trusted to tell the
+// address of the client, and the header they tell it in
+type ProxyPolicy struct {
+	// TrustedProxies are the networks of the proxies. Empty trusts none and
+	// the client is whoever opened the connection
+	TrustedProxies []netip.Prefix
+	// Header is one of ForwardedHeader, XForwardedForHeader or XRealIPHeader.
+	// Only one is read, clients could forge any other the proxies pass on
+	Header string
+}
+
+// ClientIP returns the address of the client of the request. The header is
+// only read when the connection comes from a trusted proxy. Forwarded and
+// X-Forwarded-For are walked from the right skipping trusted proxies, the
+// first address that is not one is the client, so addresses clients prepend
+// are ignored. An entry that is not an address stops the walk at the last
+// address known to be good
+func (p ProxyPolicy) ClientIP(r *http.Request) string {
+	remote, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !p.trusted(remote) {
+		return remote.String()
+	}
+
+	var hops []string
+	switch p.Header {
+	case XRealIPHeader:
+		hops = []string{strings.TrimSpace(r.Header.Get(XRealIPHeader))}
+		if hops[0] == "" {
+			hops = nil
+		}
+	case ForwardedHeader:
+		hops = forwardedFor(r.Header.Values(ForwardedHeader))
+	default:
+		for _, value := range r.Header.Values(XForwardedForHeader) {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(hops[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !p.trusted(addr) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// trusted reports if the address belongs to a trusted proxy
+func (p ProxyPolicy) trusted(addr netip.Addr) bool {
+	for _, prefix := range p.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the for parameters of the RFC 7239 Forwarded headers
+// in order, like 192.0.2.60 from for=192.0.2.60;proto=https. Elements without
+// one are kept as empty so the walk stops there
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseAddr parses an IP with an optional port, IPv6 ones in brackets if
+// they have a port. IPv4 addresses mapped to IPv6 are unmapped
+func parseAddr(value string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
@@ -0,0 +1,220 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/middleware"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+func TestProxyPolicyClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+	tests := []struct {
+		name    string
+		proxies []netip.Prefix
+		header  string
+		remote  string
+		headers http.Header
+		want    string
+	}{
+		{
+			name:    "untrusted remote with spoofed X-Forwarded-For",
+			proxies: trusted,
+			remote:  "203.0.113.7:51000",
+			headers: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "no trusted proxies",
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "X-Forwarded-For through one trusted proxy",
+			proxies: trusted,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "X-Forwarded-For through several trusted proxies",
+			proxies: trusted,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"192.0.2.66, 198.51.100.1, 10.0.0.3, 10.0.0.2"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "X-Forwarded-For split in several headers",
+			proxies: trusted,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"192.0.2.66, 198.51.100.1", "10.0.0.2"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "X-Forwarded-For of trusted proxies only",
+			proxies: trusted,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:    "10.0.0.3",
+		},
+		{
+			name:    "X-Forwarded-For with garbage past the client",
+			proxies: trusted,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"not-an-ip, 198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "X-Forwarded-For with garbage before the client",
+			proxies: trusted,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"198.51.100.1, not-an-ip"}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "X-Forwarded-For with an empty entry",
+			proxies: trusted,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"198.51.100.1, "}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "empty X-Forwarded-For",
+			proxies: trusted,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {""}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "Forwarded with a quoted IPv6 address and port",
+			proxies: trusted,
+			header:  middleware.ForwardedHeader,
+			remote:  "[::1]:51000",
+			headers: http.Header{"Forwarded": {`for=192.0.2.66, for="[2001:db8:cafe::17]:4711";proto=https`}},
+			want:    "2001:db8:cafe::17",
+		},
+		{
+			name:    "Forwarded through several trusted proxies",
+			proxies: trusted,
+			header:  middleware.ForwardedHeader,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"Forwarded": {"for=198.51.100.1;proto=https;by=10.0.0.2", "For=10.0.0.2"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "Forwarded with an obfuscated client",
+			proxies: trusted,
+			header:  middleware.ForwardedHeader,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"Forwarded": {"for=192.0.2.66, for=unknown"}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "Forwarded element without for",
+			proxies: trusted,
+			header:  middleware.ForwardedHeader,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"Forwarded": {"for=192.0.2.66, proto=https"}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "X-Forwarded-For ignored when Forwarded is configured",
+			proxies: trusted,
+			header:  middleware.ForwardedHeader,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "X-Real-IP",
+			proxies: trusted,
+			header:  middleware.XRealIPHeader,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Real-Ip": {" 198.51.100.1 "}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "X-Real-IP from an untrusted remote",
+			proxies: trusted,
+			header:  middleware.XRealIPHeader,
+			remote:  "203.0.113.7:51000",
+			headers: http.Header{"X-Real-Ip": {"198.51.100.1"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "empty X-Real-IP",
+			proxies: trusted,
+			header:  middleware.XRealIPHeader,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Real-Ip": {""}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "garbage X-Real-IP",
+			proxies: trusted,
+			header:  middleware.XRealIPHeader,
+			remote:  "10.0.0.1:51000",
+			headers: http.Header{"X-Real-Ip": {"198.51.100.1, 192.0.2.66"}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "IPv4 mapped remote",
+			proxies: trusted,
+			remote:  "[::ffff:10.0.0.1]:51000",
+			headers: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:   "remote that is not an address",
+			remote: "pipe",
+			want:   "pipe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for key, values := range tt.headers {
+				req.Header[key] = values
+			}
+
+			header := tt.header
+			if header == "" {
+				header = middleware.XForwardedForHeader
+			}
+			policy := middleware.ProxyPolicy{TrustedProxies: tt.proxies, Header: header}
+			if got := policy.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestInfoStoresClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := middleware.ProxyPolicy{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		Header:         middleware.XForwardedForHeader,
+	}
+
+	var got string
+	router := gin.New()
+	router.Use(middleware.RequestInfo(policy))
+	router.GET("/", func(ctx *gin.Context) {
+		got = util.ClientIP(ctx.Request.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:51000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.1" {
+		t.Errorf("util.ClientIP = %q, want 198.51.100.1", got)
+	}
+}
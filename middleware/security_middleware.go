@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// SecurityPolicy is the hardening applied to every request
+type SecurityPolicy struct {
+	// HSTSMaxAge is how long browsers must only use HTTPS with the API, zero
+	// doesn't send the Strict-Transport-Security header
+	HSTSMaxAge time.Duration
+	// MaxBodyBytes is the largest request body accepted by routes without a
+	// limit of their own
+	MaxBodyBytes int64
+	// AdminClientCerts requires the admin routes to be called with a client
+	// certificate verified against the client CA
+	AdminClientCerts bool
+}
+
+// SecurityHeaders sets the headers that keep browsers from sniffing, framing
+// or rendering the responses of the API. Handlers serving pages, like the
+// docs UI, replace the Content-Security-Policy with their own
+func SecurityHeaders(policy SecurityPolicy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		header := ctx.Writer.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		if policy.HSTSMaxAge > 0 {
+			header.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int64(policy.HSTSMaxAge.Seconds())))
+		}
+		ctx.Next()
+	}
+}
+
+// NoStore keeps browsers and proxies from storing the responses, for routes
+// answering with tokens or personal data
+func NoStore() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Header("Pragma", "no-cache")
+		ctx.Next()
+	}
+}
+
+// LimitBody rejects request bodies larger than limit bytes with a 413
+// problem. Bodies that announce their length are rejected before being
+// read, the rest fail when binding reads past the limit. When nested the
+// smallest limit applies
+func LimitBody(limit int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.ContentLength > limit {
+			abortWithError(ctx, util.ErrRequestBodyTooLarge.WithDetail("limit", limit))
+			return
+		}
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+		ctx.Next()
+	}
+}
+
+// RequireJSON rejects requests with a body that is not declared as JSON with
+// a 415 problem. Requests without a body, like a logout, pass
+func RequireJSON() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.ContentLength == 0 || ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+			ctx.Next()
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			abortWithError(ctx, util.ErrUnsupportedMediaType.WithDetail("accepted", []string{"application/json"}))
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireClientCert rejects requests without a verified client certificate
+// with a 403 problem. The server only verifies certificates when a client CA
+// is configured, so plain HTTP requests never pass
+func RequireClientCert() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.TLS == nil || len(ctx.Request.TLS.VerifiedChains) == 0 {
+			abortWithError(ctx, util.ErrClientCertRequired)
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,95 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/middleware"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+func TestLimitBodyAndRequireJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const limit = 16
+
+	// The handler reads the body like binding does, a body past the limit
+	// without a known length only fails there
+	router := gin.New()
+	router.Use(middleware.Errors(), middleware.LimitBody(limit), middleware.RequireJSON())
+	router.Any("/", func(ctx *gin.Context) {
+		if _, err := io.ReadAll(ctx.Request.Body); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				ctx.Error(util.ErrRequestBodyTooLarge)
+				return
+			}
+			ctx.Error(err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	})
+
+	small := `{"a":1}`
+	large := `{"a":"` + strings.Repeat("x", limit) + `"}`
+	tests := []struct {
+		name        string
+		method      string
+		body        string
+		unknownSize bool
+		contentType string
+		status      int
+		code        string
+	}{
+		{name: "JSON body", method: http.MethodPost, body: small, contentType: "application/json", status: http.StatusNoContent},
+		{name: "JSON body with charset", method: http.MethodPut, body: small, contentType: "application/json; charset=utf-8", status: http.StatusNoContent},
+		{name: "JSON media type in uppercase", method: http.MethodPost, body: small, contentType: "Application/JSON", status: http.StatusNoContent},
+		{name: "bodyless GET", method: http.MethodGet, status: http.StatusNoContent},
+		{name: "bodyless POST", method: http.MethodPost, status: http.StatusNoContent},
+		{name: "body at the limit", method: http.MethodPost, body: strings.Repeat("1", limit), contentType: "application/json", status: http.StatusNoContent},
+		{name: "oversize body", method: http.MethodPost, body: large, contentType: "application/json", status: http.StatusRequestEntityTooLarge, code: "request_body_too_large"},
+		{name: "oversize body of unknown size", method: http.MethodPost, body: large, unknownSize: true, contentType: "application/json", status: http.StatusRequestEntityTooLarge, code: "request_body_too_large"},
+		{name: "oversize body that is not JSON", method: http.MethodPost, body: large, contentType: "text/plain", status: http.StatusRequestEntityTooLarge, code: "request_body_too_large"},
+		{name: "missing Content-Type", method: http.MethodPost, body: small, status: http.StatusUnsupportedMediaType, code: "unsupported_media_type"},
+		{name: "wrong Content-Type", method: http.MethodPost, body: small, contentType: "text/plain", status: http.StatusUnsupportedMediaType, code: "unsupported_media_type"},
+		{name: "form Content-Type", method: http.MethodPut, body: "a=1", contentType: "application/x-www-form-urlencoded", status: http.StatusUnsupportedMediaType, code: "unsupported_media_type"},
+		{name: "JSON lookalike Content-Type", method: http.MethodPost, body: small, contentType: "application/jsonp", status: http.StatusUnsupportedMediaType, code: "unsupported_media_type"},
+		{name: "malformed Content-Type", method: http.MethodPost, body: small, contentType: "application/json; charset", status: http.StatusUnsupportedMediaType, code: "unsupported_media_type"},
+		{name: "body of unknown size without Content-Type", method: http.MethodPost, body: small, unknownSize: true, status: http.StatusUnsupportedMediaType, code: "unsupported_media_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest(tt.method, "/", body)
+			if tt.unknownSize {
+				req.ContentLength = -1
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.code == "" {
+				return
+			}
+			var problem struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil || problem.Code != tt.code {
+				t.Errorf("body = %s, want a %s problem", recorder.Body, tt.code)
+			}
+		})
+	}
+}
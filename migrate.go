@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/config"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/migrations"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+commands:
+  up        apply every pending migration
+  down [n]  revert the last n applied migrations (default 1)
+  status    list the migrations and whether they are applied`
+
+// migrate runs the migrate subcommand with the given arguments
+func migrate(cfg config.Config, args []string) {
+	if len(args) == 0 {
+		exitWithUsage()
+	}
+
+	ctx := context.Background()
+	db := config.ConnectToDB(cfg, nil)
+	defer db.Client().Disconnect(ctx)
+	migrator := migrations.NewMigrator(db, migrations.All())
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("Applied %d: %s\n", migration.Version, migration.Description)
+		}
+		if err != nil {
+			logging.Fatal("Error applying migrations", "error", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				exitWithUsage()
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, n)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %d: %s\n", migration.Version, migration.Description)
+		}
+		if err != nil {
+			logging.Fatal("Error reverting migrations", "error", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations")
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logging.Fatal("Error reading migrations", "error", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Migration.Version, applied, status.Migration.Description)
+		}
+		w.Flush()
+
+	default:
+		exitWithUsage()
+	}
+}
+
+// exitWithUsage prints how to use the subcommand and exits
+func exitWithUsage() {
+	fmt.Fprintln(os.Stderr, migrateUsage)
+	os.Exit(2)
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Users inserted straight into the database, like admins, which can't sign
+// themselves up (see the example init script in the README), may lack fields
+// the app always sets when registering. Can't be reverted, there is no way
+// to tell the backfilled values apart
+func init() {
+	register(Migration{
+		Version:     1,
+		Description: "backfill role and points of users missing them",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+
+			noRole := bson.M{"$or": bson.A{bson.M{"role": bson.M{"$exists": false}}, bson.M{"role": ""}}}
+			if _, err := users.UpdateMany(ctx, noRole, bson.M{"$set": bson.M{"role": "user"}}); err != nil {
+				return err
+			}
+
+			noPoints := bson.M{"points": bson.M{"$exists": false}}
+			_, err := users.UpdateMany(ctx, noPoints, bson.M{"$set": bson.M{"points": int32(500)}})
+			return err
+		},
+	})
+}
@@ -0,0 +1,47 @@
+// Package migrations reshapes the documents in the database as the models
+// evolve. Every migration has a version, migrations are applied in ascending
+// version order and reverted in descending order.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrLocked       = errors.New("another process is running migrations")
+	ErrIrreversible = errors.New("migration can't be reverted")
+	ErrUnknown      = errors.New("applied migration is not known by this binary")
+)
+
+type Migration struct {
+	Version     int64
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	// Down reverts Up. Nil if the migration can't be reverted
+	Down func(ctx context.Context, db *mongo.Database) error
+}
+
+// all are the migrations registered by the files of this package
+var all []Migration
+
+// register adds a migration to the package list. Versions must be unique
+func register(migration Migration) {
+	for _, m := range all {
+		if m.Version == migration.Version {
+			panic(fmt.Sprintf("migration %d registered twice", migration.Version))
+		}
+	}
+	all = append(all, migration)
+}
+
+// All returns every migration of this package sorted by version
+func All() []Migration {
+	migrations := append([]Migration(nil), all...)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
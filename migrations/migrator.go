@@ -0,0 +1,210 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lockID is the id of the document in the migrations collection used as lock
+const lockID = "lock"
+
+// lockLease is how long the lock is held without being refreshed. If the process
+// holding it dies the lock is free again after this time
+const lockLease = 5 * time.Minute
+
+// Status is a migration and whether it's applied to the database
+type Status struct {
+	Migration Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// applied is the document stored in the migrations collection for every applied migration
+type applied struct {
+	Version     int64     `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Migrator applies and reverts migrations keeping track of them in the
+// migrations collection. Only one migrator can run at the same time across
+// every process using the database
+type Migrator struct {
+	db         *mongo.Database
+	collection *mongo.Collection
+	migrations []Migration
+	owner      string
+}
+
+func NewMigrator(db *mongo.Database, migrations []Migration) *Migrator {
+	hostname, _ := os.Hostname()
+	return &Migrator{
+		db:         db,
+		collection: db.Collection("migrations"),
+		migrations: migrations,
+		owner:      fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()),
+	}
+}
+
+// Status returns every known migration and whether it's applied, sorted by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	done, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		a, ok := done[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: a.AppliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Migration.Version < statuses[j].Migration.Version })
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order and returns the applied ones.
+// It stops at the first one that fails
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+
+		migration := status.Migration
+		if err := m.lock(ctx); err != nil {
+			return done, err
+		}
+		if err := migration.Up(ctx, m.db); err != nil {
+			return done, fmt.Errorf("applying migration %d: %w", migration.Version, err)
+		}
+
+		_, err := m.collection.InsertOne(ctx, applied{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now(),
+		})
+		if err != nil {
+			return done, fmt.Errorf("recording migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the last n applied migrations in reverse version order and returns
+// the reverted ones. It stops at the first one that fails or can't be reverted
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	done, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int64, 0, len(done))
+	for version := range done {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	known := map[int64]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	var reverted []Migration
+	for _, version := range versions {
+		if len(reverted) == n {
+			break
+		}
+
+		migration, ok := known[version]
+		if !ok {
+			return reverted, fmt.Errorf("reverting migration %d: %w", version, ErrUnknown)
+		}
+		if migration.Down == nil {
+			return reverted, fmt.Errorf("reverting migration %d: %w", version, ErrIrreversible)
+		}
+		if err := m.lock(ctx); err != nil {
+			return reverted, err
+		}
+		if err := migration.Down(ctx, m.db); err != nil {
+			return reverted, fmt.Errorf("reverting migration %d: %w", version, err)
+		}
+		if _, err := m.collection.DeleteOne(ctx, bson.M{"_id": version}); err != nil {
+			return reverted, fmt.Errorf("recording migration %d: %w", version, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// applied returns the applied migrations by version
+func (m *Migrator) applied(ctx context.Context) (map[int64]applied, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{"_id": bson.M{"$ne": lockID}})
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []applied
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]applied, len(documents))
+	for _, document := range documents {
+		byVersion[document.Version] = document
+	}
+	return byVersion, nil
+}
+
+// lock takes the lock or extends it if this migrator already holds it. The
+// lock is a single document: if another migrator holds it and the lease hasn't
+// expired the upsert tries to insert a second one and fails with a duplicate key
+func (m *Migrator) lock(ctx context.Context) error {
+	now := time.Now()
+	filter := bson.M{
+		"_id": lockID,
+		"$or": bson.A{
+			bson.M{"owner": m.owner},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": m.owner, "expires_at": now.Add(lockLease)}}
+
+	_, err := m.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	return err
+}
+
+// unlock releases the lock if this migrator holds it
+func (m *Migrator) unlock() {
+	// Using a fresh context, the lock must be released even if ctx was cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _ = m.collection.DeleteOne(ctx, bson.M{"_id": lockID, "owner": m.owner})
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditLogin         AuditAction = "auth.login"
+	AuditRegister      AuditAction = "auth.register"
+	AuditLogout        AuditAction = "auth.logout"
+	AuditRestore       AuditAction = "auth.restore"
+	AuditPointsChanged AuditAction = "user.points_changed"
+	AuditDelete        AuditAction = "user.delete"
+)
+
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditChange is the value of a field before and after an action
+type AuditChange struct {
+	Field  string `json:"field" bson:"field"`
+	Before string `json:"before" bson:"before"`
+	After  string `json:"after" bson:"after"`
+}
+
+type AuditEvent struct {
+	ID     string      `json:"_id,omitempty" bson:"_id,omitempty"`
+	Time   time.Time   `json:"time" bson:"time"`
+	Action AuditAction `json:"action" bson:"action"`
+	// ActorID is the user performing the action, TargetID the user affected.
+	// They are the same unless an admin acts on another user
+	ActorID   string        `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	TargetID  string        `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	Username  string        `json:"username,omitempty" bson:"username,omitempty"`
+	IP        string        `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Changes   []AuditChange `json:"changes,omitempty" bson:"changes,omitempty"`
+	Outcome   AuditOutcome  `json:"outcome" bson:"outcome"`
+	Reason    string        `json:"reason,omitempty" bson:"reason,omitempty"`
+	// Sequence, PrevHash and Hash chain the events when hash chaining is enabled.
+	// Every event hashes its content and the hash of the previous one, so
+	// changing or removing an event breaks every hash after it
+	Sequence int64  `json:"seq,omitempty" bson:"seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty" bson:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty" bson:"hash,omitempty"`
+}
+
+// ComputeHash returns the hash of the event content and its PrevHash
+func (e AuditEvent) ComputeHash() string {
+	// Mongo stores dates with millisecond precision and without location
+	e.Time = e.Time.UTC().Truncate(time.Millisecond)
+	e.ID = ""
+	e.Hash = ""
+
+	content, _ := json.Marshal(e)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditChainStatus is the result of verifying the audit hash chain
+type AuditChainStatus struct {
+	Valid  bool  `json:"valid"`
+	Events int64 `json:"events"`
+	// BrokenAt is the sequence of the first event that doesn't match the chain
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
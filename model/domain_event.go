@@ -0,0 +1,118 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type DomainEventType string
+
+const (
+	UserRegistered DomainEventType = "user.registered"
+	UserLoggedIn   DomainEventType = "user.logged_in"
+	PointsChanged  DomainEventType = "user.points_changed"
+	UserDeleted    DomainEventType = "user.deleted"
+)
+
+// DomainEventTypes are every type of event the service emits
+var DomainEventTypes = []DomainEventType{UserRegistered, UserLoggedIn, PointsChanged, UserDeleted}
+
+// IsValid reports if the service emits events of this type
+func (t DomainEventType) IsValid() bool {
+	for _, eventType := range DomainEventTypes {
+		if eventType == t {
+			return true
+		}
+	}
+	return false
+}
+
+type DomainEventStatus string
+
+const (
+	DomainEventPending    DomainEventStatus = "pending"
+	DomainEventDispatched DomainEventStatus = "dispatched"
+	// DomainEventFailed events ran out of attempts and won't be retried
+	DomainEventFailed DomainEventStatus = "failed"
+)
+
+// DomainEvent is something that happened to a user other services may react
+// to. Events are stored in the outbox with the change that caused them and
+// dispatched to the sinks afterwards
+type DomainEvent struct {
+	ID         string          `json:"id" bson:"_id,omitempty"`
+	Type       DomainEventType `json:"type" bson:"type"`
+	UserID     string          `json:"user_id" bson:"user_id"`
+	OccurredAt time.Time       `json:"occurred_at" bson:"occurred_at"`
+	Data       map[string]any  `json:"data,omitempty" bson:"data,omitempty"`
+
+	// Delivery state, not part of the event itself
+	Status        DomainEventStatus `json:"-" bson:"status"`
+	Attempts      int               `json:"-" bson:"attempts"`
+	NextAttemptAt time.Time         `json:"-" bson:"next_attempt_at"`
+	LockedUntil   time.Time         `json:"-" bson:"locked_until"`
+	DeliveredTo   []string          `json:"-" bson:"delivered_to"`
+	LastError     string            `json:"-" bson:"last_error,omitempty"`
+	DispatchedAt  *time.Time        `json:"-" bson:"dispatched_at,omitempty"`
+}
+
+// IsDeliveredTo reports if the event was already delivered to the named sink
+func (e DomainEvent) IsDeliveredTo(sink string) bool {
+	for _, name := range e.DeliveredTo {
+		if name == sink {
+			return true
+		}
+	}
+	return false
+}
+
+// NewUserRegistered returns the event of the user signing up
+func NewUserRegistered(user User) DomainEvent {
+	return newDomainEvent(UserRegistered, user.ID, struct {
+		Username string `json:"username"`
+		Email    string `json:"email,omitempty"`
+		Name     string `json:"name,omitempty"`
+	}{user.Username, user.Email, user.Name})
+}
+
+// NewUserLoggedIn returns the event of the user logging in with the given
+// method, "password" or "token"
+func NewUserLoggedIn(user User, method string) DomainEvent {
+	return newDomainEvent(UserLoggedIn, user.ID, struct {
+		Username string `json:"username"`
+		Method   string `json:"method"`
+	}{user.Username, method})
+}
+
+// NewPointsChanged returns the event of the points of the user changing
+func NewPointsChanged(user User, before int32, after int32) DomainEvent {
+	return newDomainEvent(PointsChanged, user.ID, struct {
+		Before int32 `json:"before"`
+		After  int32 `json:"after"`
+	}{before, after})
+}
+
+// NewUserDeleted returns the event of the user deleting the account
+func NewUserDeleted(user User) DomainEvent {
+	return newDomainEvent(UserDeleted, user.ID, struct {
+		Username string `json:"username"`
+	}{user.Username})
+}
+
+// newDomainEvent returns a pending event. The data is kept as a generic map
+// so it looks the same to the sinks once read back from any storage
+func newDomainEvent(eventType DomainEventType, userID string, data any) DomainEvent {
+	var generic map[string]any
+	content, _ := json.Marshal(data)
+	_ = json.Unmarshal(content, &generic)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return DomainEvent{
+		Type:          eventType,
+		UserID:        userID,
+		OccurredAt:    now,
+		Data:          generic,
+		Status:        DomainEventPending,
+		NextAttemptAt: now,
+	}
+}
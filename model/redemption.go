@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type RedemptionStatus string
+
+const (
+	RedemptionPending   RedemptionStatus = "pending"
+	RedemptionFulfilled RedemptionStatus = "fulfilled"
+	RedemptionCancelled RedemptionStatus = "cancelled"
+)
+
+// CanTransitionTo reports if a redemption in status s can be moved to next.
+// Only pending redemptions can change, either fulfilled or cancelled
+func (s RedemptionStatus) CanTransitionTo(next RedemptionStatus) bool {
+	if s != RedemptionPending {
+		return false
+	}
+	return next == RedemptionFulfilled || next == RedemptionCancelled
+}
+
+type Redemption struct {
+	ID         string           `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID     string           `json:"user_id" bson:"user_id"`
+	RewardID   string           `json:"reward_id" bson:"reward_id"`
+	RewardName string           `json:"reward_name" bson:"reward_name"`
+	Cost       int32            `json:"cost" bson:"cost"`
+	Status     RedemptionStatus `json:"status" bson:"status"`
+	Since      time.Time        `json:"since" bson:"since"`
+	UpdatedAt  time.Time        `json:"updated_at" bson:"updated_at"`
+}
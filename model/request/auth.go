@@ -1,7 +1,7 @@
 package request
 
 type Auth struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Token    string `json:"token"`
+	Username string `json:"username" binding:"max=32"`
+	Password string `json:"password" binding:"max=72"`
+	Token    string `json:"token" binding:"max=128"`
 }
@@ -0,0 +1,5 @@
+package request
+
+type RedemptionStatus struct {
+	Status string `json:"status" binding:"required,oneof=fulfilled cancelled"`
+}
@@ -1,9 +1,11 @@
 package request
 
+// Register is a new account. Passwords are capped at 72 bytes, bcrypt ignores
+// the rest. Self registered accounts are always users, role only accepts user
 type Register struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Email    string `json:"email,"`
-	Name     string `json:"name,omitempty"`
-	Role     string `json:"role,omitempty"`
+	Username string `json:"username" binding:"required,min=3,max=32,username"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	Email    string `json:"email," binding:"required,max=254,email"`
+	Name     string `json:"name,omitempty" binding:"max=100"`
+	Role     string `json:"role,omitempty" binding:"omitempty,oneof=user"`
 }
@@ -0,0 +1,12 @@
+package request
+
+import "time"
+
+type Reward struct {
+	Name           string    `json:"name" binding:"required,max=100"`
+	Description    string    `json:"description,omitempty" binding:"max=1000"`
+	Cost           int32     `json:"cost" binding:"gt=0"`
+	Stock          int32     `json:"stock" binding:"gte=0"`
+	AvailableFrom  time.Time `json:"available_from"`
+	AvailableUntil time.Time `json:"available_until"`
+}
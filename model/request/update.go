@@ -1,6 +1,13 @@
 package request
 
+// Update sets the token of a user. Points are only changed by admins, see
+// Points
 type Update struct {
-	Points int32  `json:"points"`
-	Token  string `json:"token"`
+	Token string `json:"token" binding:"required,min=16,max=128,printascii"`
+}
+
+// Points is an adjustment of the balance of a user made by an admin, negative
+// to take points away
+type Points struct {
+	Points int32 `json:"points" binding:"required,min=-1000000,max=1000000"`
 }
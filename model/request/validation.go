@@ -0,0 +1,125 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// usernamePattern is the charset of usernames
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// FieldError is a field of a request that failed validation. Code is meant to
+// be matched on, message is for humans
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RegisterValidations adds the custom rules of the requests to the validator
+// gin binds with, and makes it report fields by their JSON name
+func RegisterValidations(v *validator.Validate) error {
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+}
+
+// FieldErrors returns the fields that made binding a request fail, either
+// because they broke a rule, their JSON has the wrong type or they are not
+// fields of the request. It's false if the error is not about fields, like a
+// malformed body
+func FieldErrors(err error) ([]FieldError, bool) {
+	// encoding/json reports unknown fields only in the message
+	if field, ok := strings.CutPrefix(err.Error(), `json: unknown field "`); ok {
+		return []FieldError{{
+			Field:   strings.TrimSuffix(field, `"`),
+			Code:    "unknown_field",
+			Message: "is not a field of the request",
+		}}, true
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("must be a %s", typeErr.Type.Kind()),
+		}}, true
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil, false
+	}
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		code, message := describeRule(fieldErr)
+		fields = append(fields, FieldError{Field: fieldPath(fieldErr), Code: code, Message: message})
+	}
+	return fields, true
+}
+
+// fieldPath returns the path of the field without the request struct name,
+// like event_types[0]
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, _ := strings.Cut(fieldErr.Namespace(), ".")
+	return path
+}
+
+// describeRule returns the code and message of the broken rule
+func describeRule(fieldErr validator.FieldError) (string, string) {
+	isText := fieldErr.Kind() == reflect.String
+	isList := fieldErr.Kind() == reflect.Slice || fieldErr.Kind() == reflect.Array
+	param := fieldErr.Param()
+
+	switch fieldErr.Tag() {
+	case "required":
+		return "required", "is required"
+	case "min", "gte":
+		if isText {
+			return "too_short", fmt.Sprintf("must be at least %s characters", param)
+		}
+		if isList {
+			return "too_few", fmt.Sprintf("must have at least %s items", param)
+		}
+		return "too_small", fmt.Sprintf("must be at least %s", param)
+	case "gt":
+		return "too_small", fmt.Sprintf("must be greater than %s", param)
+	case "max", "lte":
+		if isText {
+			return "too_long", fmt.Sprintf("must be at most %s characters", param)
+		}
+		if isList {
+			return "too_many", fmt.Sprintf("must have at most %s items", param)
+		}
+		return "too_large", fmt.Sprintf("must be at most %s", param)
+	case "email":
+		return "invalid_email", "must be a valid email address"
+	case "url", "http_url":
+		return "invalid_url", "must be an absolute url"
+	case "oneof":
+		return "not_allowed", fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(param), ", "))
+	case "username":
+		return "invalid_characters", "may only have letters, digits, dots, dashes and underscores"
+	case "printascii":
+		return "invalid_characters", "may only have printable ASCII characters"
+	default:
+		return "invalid", fmt.Sprintf("breaks the %s rule", fieldErr.Tag())
+	}
+}
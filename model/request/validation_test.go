@@ -0,0 +1,205 @@
+package request_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"ignaciofp.es/web-service-portfolio/model/request"
+)
+
+// bind decodes and validates body into dto like the router does
+func bind(t *testing.T, body string, dto any) error {
+	t.Helper()
+	binding.EnableDecoderDisallowUnknownFields = true
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		t.Fatalf("binding validator is %T, want *validator.Validate", binding.Validator.Engine())
+	}
+	if err := request.RegisterValidations(v); err != nil {
+		t.Fatalf("RegisterValidations error = %v", err)
+	}
+	return binding.JSON.BindBody([]byte(body), dto)
+}
+
+func TestFieldErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		dto  func() any
+		body string
+		want []request.FieldError
+	}{
+		{
+			name: "register without fields",
+			dto:  func() any { return &request.Register{} },
+			body: `{}`,
+			want: []request.FieldError{
+				{Field: "username", Code: "required", Message: "is required"},
+				{Field: "password", Code: "required", Message: "is required"},
+				{Field: "email", Code: "required", Message: "is required"},
+			},
+		},
+		{
+			name: "register with invalid fields",
+			dto:  func() any { return &request.Register{} },
+			body: `{"username":"al","password":"` + strings.Repeat("p", 73) + `","email":"alice","role":"admin"}`,
+			want: []request.FieldError{
+				{Field: "username", Code: "too_short", Message: "must be at least 3 characters"},
+				{Field: "password", Code: "too_long", Message: "must be at most 72 characters"},
+				{Field: "email", Code: "invalid_email", Message: "must be a valid email address"},
+				{Field: "role", Code: "not_allowed", Message: "must be one of user"},
+			},
+		},
+		{
+			name: "register with a username out of the charset",
+			dto:  func() any { return &request.Register{} },
+			body: `{"username":"alice smith","password":"password123","email":"alice@example.com"}`,
+			want: []request.FieldError{
+				{Field: "username", Code: "invalid_characters", Message: "may only have letters, digits, dots, dashes and underscores"},
+			},
+		},
+		{
+			name: "unknown field",
+			dto:  func() any { return &request.Register{} },
+			body: `{"username":"alice","admin":true}`,
+			want: []request.FieldError{
+				{Field: "admin", Code: "unknown_field", Message: "is not a field of the request"},
+			},
+		},
+		{
+			name: "wrong type",
+			dto:  func() any { return &request.Register{} },
+			body: `{"username":42}`,
+			want: []request.FieldError{
+				{Field: "username", Code: "invalid_type", Message: "must be a string"},
+			},
+		},
+		{
+			name: "auth with long credentials",
+			dto:  func() any { return &request.Auth{} },
+			body: `{"username":"` + strings.Repeat("a", 33) + `","password":"password123"}`,
+			want: []request.FieldError{
+				{Field: "username", Code: "too_long", Message: "must be at most 32 characters"},
+			},
+		},
+		{
+			name: "reward with invalid numbers",
+			dto:  func() any { return &request.Reward{} },
+			body: `{"name":"Mug","cost":0,"stock":-1}`,
+			want: []request.FieldError{
+				{Field: "cost", Code: "too_small", Message: "must be greater than 0"},
+				{Field: "stock", Code: "too_small", Message: "must be at least 0"},
+			},
+		},
+		{
+			name: "reward with a number of the wrong type",
+			dto:  func() any { return &request.Reward{} },
+			body: `{"name":"Mug","cost":"ten"}`,
+			want: []request.FieldError{
+				{Field: "cost", Code: "invalid_type", Message: "must be a int32"},
+			},
+		},
+		{
+			name: "points out of range",
+			dto:  func() any { return &request.Points{} },
+			body: `{"points":2000000}`,
+			want: []request.FieldError{
+				{Field: "points", Code: "too_large", Message: "must be at most 1000000"},
+			},
+		},
+		{
+			name: "points missing",
+			dto:  func() any { return &request.Points{} },
+			body: `{}`,
+			want: []request.FieldError{
+				{Field: "points", Code: "required", Message: "is required"},
+			},
+		},
+		{
+			name: "token out of the charset",
+			dto:  func() any { return &request.Update{} },
+			body: `{"token":"tokén-with-accents-0123"}`,
+			want: []request.FieldError{
+				{Field: "token", Code: "invalid_characters", Message: "may only have printable ASCII characters"},
+			},
+		},
+		{
+			name: "short token",
+			dto:  func() any { return &request.Update{} },
+			body: `{"token":"short"}`,
+			want: []request.FieldError{
+				{Field: "token", Code: "too_short", Message: "must be at least 16 characters"},
+			},
+		},
+		{
+			name: "unknown redemption status",
+			dto:  func() any { return &request.RedemptionStatus{} },
+			body: `{"status":"lost"}`,
+			want: []request.FieldError{
+				{Field: "status", Code: "not_allowed", Message: "must be one of fulfilled, cancelled"},
+			},
+		},
+		{
+			name: "webhook with invalid fields",
+			dto:  func() any { return &request.WebhookSubscription{} },
+			body: `{"url":"example.com/hook","event_types":[],"secret":"short"}`,
+			want: []request.FieldError{
+				{Field: "url", Code: "invalid_url", Message: "must be an absolute url"},
+				{Field: "event_types", Code: "too_few", Message: "must have at least 1 items"},
+				{Field: "secret", Code: "too_short", Message: "must be at least 16 characters"},
+			},
+		},
+		{
+			name: "webhook with an empty event type",
+			dto:  func() any { return &request.WebhookSubscription{} },
+			body: `{"url":"https://example.com/hook","event_types":["user.points_changed",""]}`,
+			want: []request.FieldError{
+				{Field: "event_types[1]", Code: "required", Message: "is required"},
+			},
+		},
+		{
+			name: "webhook with too many event types",
+			dto:  func() any { return &request.WebhookSubscription{} },
+			body: `{"url":"https://example.com/hook","event_types":["a"` + strings.Repeat(`,"a"`, 20) + `]}`,
+			want: []request.FieldError{
+				{Field: "event_types", Code: "too_many", Message: "must have at most 20 items"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := bind(t, tt.body, tt.dto())
+			if err == nil {
+				t.Fatalf("bind error = nil, want %v", tt.want)
+			}
+			fields, ok := request.FieldErrors(err)
+			if !ok {
+				t.Fatalf("FieldErrors(%v) is not about fields", err)
+			}
+			if !slices.Equal(fields, tt.want) {
+				t.Errorf("FieldErrors = %+v, want %+v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldErrorsNotAboutFields(t *testing.T) {
+	err := bind(t, `{"username":`, &request.Register{})
+	if err == nil {
+		t.Fatalf("bind error = nil, want a syntax error")
+	}
+	if fields, ok := request.FieldErrors(err); ok {
+		t.Errorf("FieldErrors = %+v, want none for a malformed body", fields)
+	}
+}
+
+func TestValidRequestsBind(t *testing.T) {
+	if err := bind(t, `{"username":"alice.smith","password":"password123","email":"alice@example.com","name":"Alice"}`, &request.Register{}); err != nil {
+		t.Errorf("bind register error = %v", err)
+	}
+	if err := bind(t, `{"url":"https://example.com/hook","event_types":["user.points_changed"],"secret":"0123456789abcdef"}`, &request.WebhookSubscription{}); err != nil {
+		t.Errorf("bind webhook error = %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+package request
+
+type WebhookSubscription struct {
+	URL        string   `json:"url" binding:"required,max=2048,url"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,max=20,dive,required,max=64"`
+	Secret     string   `json:"secret,omitempty" binding:"omitempty,min=16,max=256,printascii"`
+	Active     *bool    `json:"active,omitempty"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+type Reward struct {
+	ID             string    `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name           string    `json:"name" bson:"name"`
+	Description    string    `json:"description,omitempty" bson:"description"`
+	Cost           int32     `json:"cost" bson:"cost"`
+	Stock          int32     `json:"stock" bson:"stock"`
+	AvailableFrom  time.Time `json:"available_from" bson:"available_from"`
+	AvailableUntil time.Time `json:"available_until" bson:"available_until"`
+	Since          time.Time `json:"since" bson:"since"`
+}
+
+// IsAvailable reports if the reward can be redeemed at the given time. A zero
+// AvailableFrom or AvailableUntil means the window is open on that side
+func (r Reward) IsAvailable(at time.Time) bool {
+	if r.Stock <= 0 {
+		return false
+	}
+	if !r.AvailableFrom.IsZero() && at.Before(r.AvailableFrom) {
+		return false
+	}
+	if !r.AvailableUntil.IsZero() && !at.Before(r.AvailableUntil) {
+		return false
+	}
+	return true
+}
@@ -13,4 +13,34 @@ type User struct {
 	LastSeen time.Time `json:"last_seen" bson:"last_seen"`
 	Since    time.Time `json:"since" bson:"since"`
 	Points   int32     `json:"points" bson:"points"`
+	// DeletedAt is set when the user deletes the account. Deleted users are
+	// hidden until they restore the account or it's purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// Profile is the user as v2 of the API shows it. The id is "id" instead of
+// "_id" and the token, which the client already has, isn't echoed back
+type Profile struct {
+	ID       string    `json:"id"`
+	Username string    `json:"username"`
+	Name     string    `json:"name,omitempty"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	Points   int32     `json:"points"`
+	LastSeen time.Time `json:"last_seen"`
+	Since    time.Time `json:"since"`
+}
+
+// NewProfile returns the profile of the user
+func NewProfile(user User) Profile {
+	return Profile{
+		ID:       user.ID,
+		Username: user.Username,
+		Name:     user.Name,
+		Email:    user.Email,
+		Role:     user.Role,
+		Points:   user.Points,
+		LastSeen: user.LastSeen,
+		Since:    user.Since,
+	}
 }
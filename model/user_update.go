@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+type UserUpdateType string
+
+const (
+	// UserSnapshot is the current state of the user, sent when a stream starts
+	UserSnapshot      UserUpdateType = "snapshot"
+	UserProfileUpdate UserUpdateType = "profile"
+	UserPointsUpdate  UserUpdateType = "points"
+	UserDeletedUpdate UserUpdateType = "deleted"
+)
+
+// UserUpdate is a change of a user pushed to the user's open streams. The id
+// lets a reconnecting client resume right after the last update it received
+type UserUpdate struct {
+	ID   string         `json:"-"`
+	Type UserUpdateType `json:"type"`
+	User User           `json:"user"`
+	Time time.Time      `json:"time"`
+}
+
+// NewUserUpdate returns an update of the given type without the password and
+// token of the user, which must never be streamed
+func NewUserUpdate(id string, updateType UserUpdateType, user User) UserUpdate {
+	user.Password = ""
+	user.Token = ""
+	return UserUpdate{ID: id, Type: updateType, User: user, Time: time.Now().UTC()}
+}
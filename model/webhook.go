@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// WebhookSubscription is a partner endpoint that receives the domain events of
+// the given types as signed HTTP callbacks
+type WebhookSubscription struct {
+	ID         string            `json:"_id,omitempty" bson:"_id,omitempty"`
+	URL        string            `json:"url" bson:"url"`
+	EventTypes []DomainEventType `json:"event_types" bson:"event_types"`
+	// Secret signs the payloads, it's only shown when the subscription is created
+	Secret string    `json:"secret,omitempty" bson:"secret"`
+	Active bool      `json:"active" bson:"active"`
+	Since  time.Time `json:"since" bson:"since"`
+}
+
+// Wants reports if the subscription receives events of the given type
+func (s WebhookSubscription) Wants(eventType DomainEventType) bool {
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDeliveryDead deliveries ran out of attempts, they are only sent
+	// again if replayed
+	WebhookDeliveryDead WebhookDeliveryStatus = "dead"
+)
+
+// WebhookDelivery is a domain event on its way to a subscription. The payload
+// is kept so retries and replays send exactly the same body
+type WebhookDelivery struct {
+	ID             string                `json:"_id,omitempty" bson:"_id,omitempty"`
+	SubscriptionID string                `json:"subscription_id" bson:"subscription_id"`
+	EventID        string                `json:"event_id" bson:"event_id"`
+	EventType      DomainEventType       `json:"event_type" bson:"event_type"`
+	Payload        string                `json:"payload" bson:"payload"`
+	Status         WebhookDeliveryStatus `json:"status" bson:"status"`
+	Attempts       []WebhookAttempt      `json:"attempts" bson:"attempts"`
+	// Tries counts the failed attempts since the delivery was queued or replayed
+	Tries         int        `json:"tries" bson:"tries"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LockedUntil   time.Time  `json:"-" bson:"locked_until"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+// WebhookAttempt is the log of a single try to deliver a webhook
+type WebhookAttempt struct {
+	Time       time.Time     `json:"time" bson:"time"`
+	StatusCode int           `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty" bson:"error,omitempty"`
+	Duration   time.Duration `json:"duration" bson:"duration"`
+}
+
+// Succeeded reports if the receiver acknowledged the webhook with a 2xx status
+func (a WebhookAttempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
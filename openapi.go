@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"ignaciofp.es/web-service-portfolio/config"
+	"ignaciofp.es/web-service-portfolio/docs"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/router"
+)
+
+const openapiUsage = `usage: openapi <command>
+
+commands:
+  print  write the OpenAPI document to stdout
+  check  fail if a route is missing from the document or an operation has no route`
+
+// openapi runs the openapi subcommand with the given arguments
+func openapi(cfg config.Config, args []string) {
+	if len(args) == 0 {
+		exitWithOpenAPIUsage()
+	}
+
+	switch args[0] {
+	case "print":
+		os.Stdout.Write(docs.Spec)
+
+	case "check":
+		// Only the routes are needed, run it with STORAGE=memory to build
+		// them without a database
+		app := router.Init(config.Init(cfg))
+
+		missing, unrouted, err := docs.Coverage(router.VersionedRoutes(app.Routes()))
+		if err != nil {
+			logging.Fatal("Error checking the OpenAPI document", "error", err)
+		}
+		for _, operation := range missing {
+			fmt.Printf("Missing from openapi.json: %s\n", operation)
+		}
+		for _, operation := range unrouted {
+			fmt.Printf("No route for: %s\n", operation)
+		}
+		if len(missing) > 0 || len(unrouted) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("Every route is documented")
+
+	default:
+		exitWithOpenAPIUsage()
+	}
+}
+
+// exitWithOpenAPIUsage prints how to use the subcommand and exits
+func exitWithOpenAPIUsage() {
+	fmt.Fprintln(os.Stderr, openapiUsage)
+	os.Exit(2)
+}
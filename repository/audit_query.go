@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/model"
+)
+
+// AuditQuery filters and paginates audit events independently of the storage.
+// Empty fields are ignored
+type AuditQuery struct {
+	Action   model.AuditAction
+	ActorID  string
+	TargetID string
+	Outcome  model.AuditOutcome
+	IP       string
+	From     time.Time
+	To       time.Time
+	Offset   int64
+	Limit    int64
+}
+
+// Matches reports if the event meets every filter of the query
+func (q AuditQuery) Matches(event model.AuditEvent) bool {
+	return (q.Action == "" || q.Action == event.Action) &&
+		(q.ActorID == "" || q.ActorID == event.ActorID) &&
+		(q.TargetID == "" || q.TargetID == event.TargetID) &&
+		(q.Outcome == "" || q.Outcome == event.Outcome) &&
+		(q.IP == "" || q.IP == event.IP) &&
+		(q.From.IsZero() || !event.Time.Before(q.From)) &&
+		(q.To.IsZero() || event.Time.Before(q.To))
+}
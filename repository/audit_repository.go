@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type AuditRepository interface {
+	CreateEvent(ctx context.Context, event model.AuditEvent) error
+	GetEvents(ctx context.Context, query AuditQuery) ([]model.AuditEvent, int64, error)
+	GetLastChained(ctx context.Context) (model.AuditEvent, error)
+	GetChain(ctx context.Context, afterSequence int64, limit int64) ([]model.AuditEvent, error)
+}
+
+type AuditRepositoryImpl struct {
+	db              *mongo.Database
+	auditCollection *mongo.Collection
+}
+
+func AuditRepositoryInit(db *mongo.Database) *AuditRepositoryImpl {
+	return &AuditRepositoryImpl{db: db, auditCollection: db.Collection("audit_events")}
+}
+
+// CreateEvent appends an event to the audit log. If the event is chained and its
+// sequence is already taken by another event it returns ErrAuditSequenceTaken
+func (r AuditRepositoryImpl) CreateEvent(ctx context.Context, event model.AuditEvent) error {
+	event.ID = ""
+	if _, err := r.auditCollection.InsertOne(ctx, event); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return util.ErrAuditSequenceTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// GetEvents returns a page of the events that match the query, newest first,
+// and how many events match in total
+func (r AuditRepositoryImpl) GetEvents(ctx context.Context, query AuditQuery) ([]model.AuditEvent, int64, error) {
+	filter := bson.M{}
+	if query.Action != "" {
+		filter["action"] = query.Action
+	}
+	if query.ActorID != "" {
+		filter["actor_id"] = query.ActorID
+	}
+	if query.TargetID != "" {
+		filter["target_id"] = query.TargetID
+	}
+	if query.Outcome != "" {
+		filter["outcome"] = query.Outcome
+	}
+	if query.IP != "" {
+		filter["ip"] = query.IP
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		timeFilter := bson.M{}
+		if !query.From.IsZero() {
+			timeFilter["$gte"] = query.From
+		}
+		if !query.To.IsZero() {
+			timeFilter["$lt"] = query.To
+		}
+		filter["time"] = timeFilter
+	}
+
+	total, err := r.auditCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(query.Offset).
+		SetLimit(query.Limit)
+	cursor, err := r.auditCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events := []model.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// GetLastChained returns the chained event with the highest sequence
+func (r AuditRepositoryImpl) GetLastChained(ctx context.Context) (model.AuditEvent, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+
+	var result model.AuditEvent
+	if err := r.auditCollection.FindOne(ctx, bson.M{"seq": bson.M{"$gt": 0}}, opts).Decode(&result); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.AuditEvent{}, util.ErrAuditEventNotFound
+		}
+		return model.AuditEvent{}, err
+	}
+	return result, nil
+}
+
+// GetChain returns up to limit chained events with a sequence greater than
+// afterSequence, in sequence order
+func (r AuditRepositoryImpl) GetChain(ctx context.Context, afterSequence int64, limit int64) ([]model.AuditEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(limit)
+	cursor, err := r.auditCollection.Find(ctx, bson.M{"seq": bson.M{"$gt": afterSequence}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []model.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
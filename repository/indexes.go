@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// caseInsensitive is the collation of the unique user indexes. Queries must use
+// it too to match the same documents the index considers duplicated
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// dispatchedRetention is how long dispatched events are kept in the outbox
+const dispatchedRetention = 7 * 24 * time.Hour
+
+// IndexSpec declares an index the app needs in a collection
+type IndexSpec struct {
+	Collection string
+	Name       string
+	Keys       bson.D
+	Unique     bool
+	// Collation used to compare the keys, nil for binary comparison
+	Collation *options.Collation
+	// PartialFilter restricts the index to the documents that match it
+	PartialFilter bson.D
+	// ExpireAfter makes it a TTL index, documents are removed once the date
+	// in the (single) key field is older than this. Zero for no expiration
+	ExpireAfter time.Duration
+}
+
+// Indexes are the indexes every collection must have
+var Indexes = []IndexSpec{
+	{
+		Collection: "users",
+		Name:       "username_unique",
+		Keys:       bson.D{{Key: "username", Value: 1}},
+		Unique:     true,
+		Collation:  caseInsensitive,
+	},
+	{
+		// Users registered without email don't collide with each other
+		Collection:    "users",
+		Name:          "email_unique",
+		Keys:          bson.D{{Key: "email", Value: 1}},
+		Unique:        true,
+		Collation:     caseInsensitive,
+		PartialFilter: bson.D{{Key: "email", Value: bson.D{{Key: "$gt", Value: ""}}}},
+	},
+	{
+		Collection: "users",
+		Name:       "token",
+		Keys:       bson.D{{Key: "token", Value: 1}},
+	},
+	{
+		// Only deleted users are indexed, used to find the ones to purge
+		Collection:    "users",
+		Name:          "deleted_at",
+		Keys:          bson.D{{Key: "deleted_at", Value: 1}},
+		PartialFilter: bson.D{{Key: "deleted_at", Value: bson.D{{Key: "$exists", Value: true}}}},
+	},
+	{
+		Collection: "redemptions",
+		Name:       "user_history",
+		Keys:       bson.D{{Key: "user_id", Value: 1}, {Key: "since", Value: -1}},
+	},
+	{
+		Collection: "audit_events",
+		Name:       "time",
+		Keys:       bson.D{{Key: "time", Value: -1}},
+	},
+	{
+		Collection: "audit_events",
+		Name:       "target_time",
+		Keys:       bson.D{{Key: "target_id", Value: 1}, {Key: "time", Value: -1}},
+	},
+	{
+		Collection: "audit_events",
+		Name:       "actor_time",
+		Keys:       bson.D{{Key: "actor_id", Value: 1}, {Key: "time", Value: -1}},
+	},
+	{
+		Collection: "audit_events",
+		Name:       "action_time",
+		Keys:       bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}},
+	},
+	{
+		// Two events can't take the same place in the hash chain
+		Collection:    "audit_events",
+		Name:          "seq_unique",
+		Keys:          bson.D{{Key: "seq", Value: 1}},
+		Unique:        true,
+		PartialFilter: bson.D{{Key: "seq", Value: bson.D{{Key: "$gt", Value: 0}}}},
+	},
+	{
+		// Finding the next event to dispatch
+		Collection: "outbox",
+		Name:       "pending",
+		Keys:       bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+	},
+	{
+		// Dispatched events are only kept for a week
+		Collection:  "outbox",
+		Name:        "dispatched_ttl",
+		Keys:        bson.D{{Key: "dispatched_at", Value: 1}},
+		ExpireAfter: dispatchedRetention,
+	},
+	{
+		// An event is delivered once per subscription, even if the sink gets it twice
+		Collection: "webhook_deliveries",
+		Name:       "subscription_event_unique",
+		Keys:       bson.D{{Key: "subscription_id", Value: 1}, {Key: "event_id", Value: 1}},
+		Unique:     true,
+	},
+	{
+		// Delivery logs of a subscription
+		Collection: "webhook_deliveries",
+		Name:       "subscription_created",
+		Keys:       bson.D{{Key: "subscription_id", Value: 1}, {Key: "created_at", Value: -1}},
+	},
+	{
+		// Finding the next delivery to send
+		Collection: "webhook_deliveries",
+		Name:       "pending",
+		Keys:       bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+	},
+}
+
+// IndexDrift is a difference between the declared indexes and the ones in the database
+type IndexDrift struct {
+	Collection string
+	Index      string
+	// Problem is one of "missing", "changed" or "undeclared". Undeclared indexes
+	// are only reported, they are never dropped
+	Problem string
+	Detail  string
+	// unique is set if the index in the database is unique
+	unique bool
+}
+
+func (d IndexDrift) String() string {
+	s := fmt.Sprintf("%s.%s: %s", d.Collection, d.Index, d.Problem)
+	if d.Detail != "" {
+		s += " (" + d.Detail + ")"
+	}
+	return s
+}
+
+// CheckIndexes compares the declared indexes with the ones in the database and returns the differences
+func CheckIndexes(ctx context.Context, db *mongo.Database, specs []IndexSpec) ([]IndexDrift, error) {
+	byCollection := map[string][]IndexSpec{}
+	var collections []string
+	for _, spec := range specs {
+		if _, ok := byCollection[spec.Collection]; !ok {
+			collections = append(collections, spec.Collection)
+		}
+		byCollection[spec.Collection] = append(byCollection[spec.Collection], spec)
+	}
+
+	drifts := []IndexDrift{}
+	for _, collection := range collections {
+		existing, err := listIndexes(ctx, db.Collection(collection))
+		if err != nil {
+			return nil, err
+		}
+
+		declared := map[string]bool{"_id_": true}
+		for _, spec := range byCollection[collection] {
+			declared[spec.Name] = true
+
+			index, ok := existing[spec.Name]
+			if !ok {
+				drifts = append(drifts, IndexDrift{Collection: collection, Index: spec.Name, Problem: "missing"})
+				continue
+			}
+			if detail := index.diff(spec); detail != "" {
+				drifts = append(drifts, IndexDrift{Collection: collection, Index: spec.Name, Problem: "changed", Detail: detail, unique: index.Unique})
+			}
+		}
+
+		for name := range existing {
+			if !declared[name] {
+				drifts = append(drifts, IndexDrift{Collection: collection, Index: name, Problem: "undeclared"})
+			}
+		}
+	}
+	return drifts, nil
+}
+
+// EnsureIndexes creates the missing indexes and recreates the changed ones. It
+// returns the drift found before fixing it.
+//
+// A changed index is dropped before its replacement is created, so a unique
+// index would stop enforcing its constraint in between and duplicates could
+// slip in. Changed unique indexes are never dropped, if there's any nothing is
+// fixed and util.ErrUniqueIndexChanged is returned for them
+func EnsureIndexes(ctx context.Context, db *mongo.Database, specs []IndexSpec) ([]IndexDrift, error) {
+	drifts, err := CheckIndexes(ctx, db, specs)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, drift := range drifts {
+		if drift.Problem == "changed" && drift.unique {
+			errs = append(errs, fmt.Errorf("index %s: %w", drift, util.ErrUniqueIndexChanged))
+		}
+	}
+	if len(errs) > 0 {
+		return drifts, errors.Join(errs...)
+	}
+
+	byName := map[string]IndexSpec{}
+	for _, spec := range specs {
+		byName[spec.Collection+"."+spec.Name] = spec
+	}
+
+	for _, drift := range drifts {
+		spec, ok := byName[drift.Collection+"."+drift.Index]
+		if !ok {
+			continue
+		}
+
+		indexes := db.Collection(spec.Collection).Indexes()
+		if drift.Problem == "changed" {
+			if _, err := indexes.DropOne(ctx, spec.Name); err != nil {
+				return drifts, fmt.Errorf("dropping index %s: %w", drift, err)
+			}
+		}
+		if _, err := indexes.CreateOne(ctx, spec.model()); err != nil {
+			return drifts, fmt.Errorf("creating index %s: %w", drift, err)
+		}
+	}
+	return drifts, nil
+}
+
+// model returns the mongo index model for the spec
+func (s IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(s.Name)
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+	if s.Collation != nil {
+		opts.SetCollation(s.Collation)
+	}
+	if s.PartialFilter != nil {
+		opts.SetPartialFilterExpression(s.PartialFilter)
+	}
+	if s.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int32(s.ExpireAfter.Seconds()))
+	}
+	return mongo.IndexModel{Keys: s.Keys, Options: opts}
+}
+
+// existingIndex are the fields of an index in the database that specs can declare
+type existingIndex struct {
+	Name                    string   `bson:"name"`
+	Key                     bson.D   `bson:"key"`
+	Unique                  bool     `bson:"unique"`
+	ExpireAfterSeconds      *float64 `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.D   `bson:"partialFilterExpression"`
+	Collation               *struct {
+		Locale   string `bson:"locale"`
+		Strength int    `bson:"strength"`
+	} `bson:"collation"`
+}
+
+// diff describes how the index differs from the spec, or returns an empty string if they match
+func (i existingIndex) diff(spec IndexSpec) string {
+	if fmt.Sprint(normalizeKeys(i.Key)) != fmt.Sprint(normalizeKeys(spec.Keys)) {
+		return fmt.Sprintf("keys are %v, want %v", i.Key, spec.Keys)
+	}
+	if i.Unique != spec.Unique {
+		return fmt.Sprintf("unique is %t, want %t", i.Unique, spec.Unique)
+	}
+
+	var locale string
+	var strength int
+	if i.Collation != nil {
+		locale, strength = i.Collation.Locale, i.Collation.Strength
+	}
+	var wantLocale string
+	var wantStrength int
+	if spec.Collation != nil {
+		wantLocale, wantStrength = spec.Collation.Locale, spec.Collation.Strength
+	}
+	if locale != wantLocale || strength != wantStrength {
+		return fmt.Sprintf("collation is %q strength %d, want %q strength %d", locale, strength, wantLocale, wantStrength)
+	}
+
+	var expireAfter time.Duration
+	if i.ExpireAfterSeconds != nil {
+		expireAfter = time.Duration(*i.ExpireAfterSeconds) * time.Second
+	}
+	if expireAfter != spec.ExpireAfter.Truncate(time.Second) {
+		return fmt.Sprintf("expires after %s, want %s", expireAfter, spec.ExpireAfter)
+	}
+
+	filter, _ := bson.MarshalExtJSON(i.PartialFilterExpression, false, false)
+	wantFilter, _ := bson.MarshalExtJSON(spec.PartialFilter, false, false)
+	if i.PartialFilterExpression == nil {
+		filter = nil
+	}
+	if spec.PartialFilter == nil {
+		wantFilter = nil
+	}
+	if string(filter) != string(wantFilter) {
+		return fmt.Sprintf("partial filter is %s, want %s", filter, wantFilter)
+	}
+	return ""
+}
+
+// normalizeKeys turns the numeric directions of the keys into float64, the server
+// may return them with a different numeric type than the one they were created with
+func normalizeKeys(keys bson.D) bson.D {
+	normalized := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		value := key.Value
+		switch v := value.(type) {
+		case int:
+			value = float64(v)
+		case int32:
+			value = float64(v)
+		case int64:
+			value = float64(v)
+		}
+		normalized = append(normalized, bson.E{Key: key.Key, Value: value})
+	}
+	return normalized
+}
+
+// listIndexes returns the indexes of the collection by name. A collection that
+// doesn't exist yet has no indexes
+func listIndexes(ctx context.Context, collection *mongo.Collection) (map[string]existingIndex, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == 26 { // NamespaceNotFound
+			return map[string]existingIndex{}, nil
+		}
+		return nil, err
+	}
+
+	var indexes []existingIndex
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]existingIndex, len(indexes))
+	for _, index := range indexes {
+		byName[index.Name] = index
+	}
+	return byName, nil
+}
@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// TestEnsureIndexesKeepsChangedUniqueIndexes runs against MongoDB, it's skipped
+// unless MONGO_TEST_URI points to a server
+func TestEnsureIndexesKeepsChangedUniqueIndexes(t *testing.T) {
+	client := mongoClient(t)
+	ctx := context.Background()
+	db := client.Database(fmt.Sprintf("test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() { db.Drop(context.Background()) })
+
+	unique := repository.IndexSpec{Collection: "items", Name: "code_unique", Keys: bson.D{{Key: "code", Value: 1}}, Unique: true}
+	plain := repository.IndexSpec{Collection: "items", Name: "created", Keys: bson.D{{Key: "created", Value: 1}}}
+	if _, err := repository.EnsureIndexes(ctx, db, []repository.IndexSpec{unique, plain}); err != nil {
+		t.Fatalf("EnsureIndexes error = %v", err)
+	}
+
+	changedUnique := unique
+	changedUnique.Keys = bson.D{{Key: "code", Value: 1}, {Key: "region", Value: 1}}
+	changedPlain := plain
+	changedPlain.Keys = bson.D{{Key: "created", Value: -1}}
+	specs := []repository.IndexSpec{changedUnique, changedPlain}
+
+	drifts, err := repository.EnsureIndexes(ctx, db, specs)
+	if !errors.Is(err, util.ErrUniqueIndexChanged) {
+		t.Fatalf("EnsureIndexes error = %v, want %v", err, util.ErrUniqueIndexChanged)
+	}
+	if len(drifts) != 2 {
+		t.Errorf("drifts = %v, want both indexes changed", drifts)
+	}
+
+	// Nothing is fixed while a unique index is changed, the constraint is kept
+	if _, err := db.Collection("items").InsertOne(ctx, bson.M{"code": "A", "region": "eu"}); err != nil {
+		t.Fatalf("InsertOne error = %v", err)
+	}
+	if _, err := db.Collection("items").InsertOne(ctx, bson.M{"code": "A", "region": "us"}); err == nil {
+		t.Errorf("duplicated code inserted, want the unique index kept")
+	}
+	drifts, err = repository.CheckIndexes(ctx, db, specs)
+	if err != nil || len(drifts) != 2 {
+		t.Errorf("CheckIndexes = %v, %v, want both indexes still changed", drifts, err)
+	}
+}
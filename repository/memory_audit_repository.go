@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// MemoryAuditRepositoryImpl is an AuditRepository that keeps the events in
+// memory. It behaves like AuditRepositoryImpl
+type MemoryAuditRepositoryImpl struct {
+	mu     *sync.RWMutex
+	events *[]model.AuditEvent
+}
+
+func MemoryAuditRepositoryInit() *MemoryAuditRepositoryImpl {
+	return &MemoryAuditRepositoryImpl{mu: &sync.RWMutex{}, events: &[]model.AuditEvent{}}
+}
+
+// CreateEvent appends an event to the audit log. If the event is chained and its
+// sequence is already taken by another event it returns ErrAuditSequenceTaken
+func (r MemoryAuditRepositoryImpl) CreateEvent(ctx context.Context, event model.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Sequence > 0 {
+		for _, e := range *r.events {
+			if e.Sequence == event.Sequence {
+				return util.ErrAuditSequenceTaken
+			}
+		}
+	}
+
+	event.ID = primitive.NewObjectID().Hex()
+	*r.events = append(*r.events, event)
+	return nil
+}
+
+// GetEvents returns a page of the events that match the query, newest first,
+// and how many events match in total
+func (r MemoryAuditRepositoryImpl) GetEvents(ctx context.Context, query AuditQuery) ([]model.AuditEvent, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matching := []model.AuditEvent{}
+	for i := len(*r.events) - 1; i >= 0; i-- {
+		if event := (*r.events)[i]; query.Matches(event) {
+			matching = append(matching, event)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].Time.After(matching[j].Time) })
+
+	total := int64(len(matching))
+	start := min(query.Offset, total)
+	end := total
+	if query.Limit > 0 {
+		end = min(start+query.Limit, total)
+	}
+	return matching[start:end], total, nil
+}
+
+// GetLastChained returns the chained event with the highest sequence
+func (r MemoryAuditRepositoryImpl) GetLastChained(ctx context.Context) (model.AuditEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var last model.AuditEvent
+	for _, event := range *r.events {
+		if event.Sequence > last.Sequence {
+			last = event
+		}
+	}
+	if last.Sequence == 0 {
+		return model.AuditEvent{}, util.ErrAuditEventNotFound
+	}
+	return last, nil
+}
+
+// GetChain returns up to limit chained events with a sequence greater than
+// afterSequence, in sequence order
+func (r MemoryAuditRepositoryImpl) GetChain(ctx context.Context, afterSequence int64, limit int64) ([]model.AuditEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	chain := []model.AuditEvent{}
+	for _, event := range *r.events {
+		if event.Sequence > afterSequence {
+			chain = append(chain, event)
+		}
+	}
+	sort.Slice(chain, func(i, j int) bool { return chain[i].Sequence < chain[j].Sequence })
+
+	if int64(len(chain)) > limit {
+		chain = chain[:limit]
+	}
+	return chain, nil
+}
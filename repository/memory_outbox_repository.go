@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// MemoryOutboxRepositoryImpl is an OutboxRepository that keeps the events in
+// memory. It behaves like OutboxRepositoryImpl
+type MemoryOutboxRepositoryImpl struct {
+	mu     *sync.Mutex
+	events map[string]model.DomainEvent
+}
+
+func MemoryOutboxRepositoryInit() *MemoryOutboxRepositoryImpl {
+	return &MemoryOutboxRepositoryImpl{mu: &sync.Mutex{}, events: map[string]model.DomainEvent{}}
+}
+
+// AddEvents stores pending events in the outbox
+func (r MemoryOutboxRepositoryImpl) AddEvents(ctx context.Context, events ...model.DomainEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range events {
+		event.ID = primitive.NewObjectID().Hex()
+		r.events[event.ID] = event
+	}
+	return nil
+}
+
+// ClaimNext takes the oldest pending event due for delivery and locks it for the lease
+func (r MemoryOutboxRepositoryImpl) ClaimNext(ctx context.Context, lease time.Duration) (model.DomainEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var next model.DomainEvent
+	for _, event := range r.events {
+		if event.Status != model.DomainEventPending || event.NextAttemptAt.After(now) || event.LockedUntil.After(now) {
+			continue
+		}
+		if next.ID == "" || event.NextAttemptAt.Before(next.NextAttemptAt) {
+			next = event
+		}
+	}
+	if next.ID == "" {
+		return model.DomainEvent{}, util.ErrOutboxEmpty
+	}
+
+	next.LockedUntil = now.Add(lease)
+	next.Attempts++
+	r.events[next.ID] = next
+	return next, nil
+}
+
+// MarkDelivered records that the event reached the named sink
+func (r MemoryOutboxRepositoryImpl) MarkDelivered(ctx context.Context, id string, sink string) error {
+	return r.update(id, func(event *model.DomainEvent) {
+		if !event.IsDeliveredTo(sink) {
+			event.DeliveredTo = append(event.DeliveredTo, sink)
+		}
+	})
+}
+
+// MarkDispatched records that the event reached every sink. Events dispatched
+// longer than the retention ago are removed, like the TTL index of mongo does
+func (r MemoryOutboxRepositoryImpl) MarkDispatched(ctx context.Context, id string) error {
+	now := time.Now()
+	err := r.update(id, func(event *model.DomainEvent) {
+		event.Status = model.DomainEventDispatched
+		event.DispatchedAt = &now
+		event.LockedUntil = time.Time{}
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, event := range r.events {
+		if event.DispatchedAt != nil && now.Sub(*event.DispatchedAt) > dispatchedRetention {
+			delete(r.events, id)
+		}
+	}
+	return nil
+}
+
+// MarkRetry unlocks the event so it's retried at nextAttemptAt, or marks it as failed
+func (r MemoryOutboxRepositoryImpl) MarkRetry(ctx context.Context, id string, nextAttemptAt time.Time, lastError string, failed bool) error {
+	return r.update(id, func(event *model.DomainEvent) {
+		event.Status = model.DomainEventPending
+		if failed {
+			event.Status = model.DomainEventFailed
+		}
+		event.NextAttemptAt = nextAttemptAt
+		event.LastError = lastError
+		event.LockedUntil = time.Time{}
+	})
+}
+
+// update applies fn to the event with the given id
+func (r MemoryOutboxRepositoryImpl) update(id string, fn func(event *model.DomainEvent)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.events[id]
+	if !ok {
+		return util.ErrDomainEventNotFound
+	}
+	fn(&event)
+	r.events[id] = event
+	return nil
+}
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// MemoryRewardRepositoryImpl is a RewardRepository that keeps the catalog and
+// the redemptions in memory. It behaves like RewardRepositoryImpl
+type MemoryRewardRepositoryImpl struct {
+	mu          *sync.RWMutex
+	rewards     map[string]model.Reward
+	redemptions map[string]model.Redemption
+}
+
+func MemoryRewardRepositoryInit() *MemoryRewardRepositoryImpl {
+	return &MemoryRewardRepositoryImpl{
+		mu:          &sync.RWMutex{},
+		rewards:     map[string]model.Reward{},
+		redemptions: map[string]model.Redemption{},
+	}
+}
+
+// GetRewards returns the reward catalog sorted by cost. If onlyAvailable is set
+// only the rewards in stock and inside their availability window are returned
+func (r MemoryRewardRepositoryImpl) GetRewards(ctx context.Context, onlyAvailable bool) ([]model.Reward, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	rewards := []model.Reward{}
+	for _, reward := range r.rewards {
+		if !onlyAvailable || reward.IsAvailable(now) {
+			rewards = append(rewards, reward)
+		}
+	}
+	sort.SliceStable(rewards, func(i, j int) bool { return rewards[i].Cost < rewards[j].Cost })
+	return rewards, nil
+}
+
+// GetReward finds a reward by its id
+func (r MemoryRewardRepositoryImpl) GetReward(ctx context.Context, id string) (model.Reward, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reward, ok := r.rewards[id]
+	if !ok {
+		return model.Reward{}, util.ErrRewardNotFound
+	}
+	return reward, nil
+}
+
+// CreateReward stores a new reward and returns it with its new id
+func (r MemoryRewardRepositoryImpl) CreateReward(ctx context.Context, reward model.Reward) (model.Reward, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reward.ID = primitive.NewObjectID().Hex()
+	r.rewards[reward.ID] = reward
+	return reward, nil
+}
+
+// UpdateReward replaces every editable field of the reward with the same id
+func (r MemoryRewardRepositoryImpl) UpdateReward(ctx context.Context, reward model.Reward) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.rewards[reward.ID]
+	if !ok {
+		return util.ErrRewardNotFound
+	}
+
+	reward.Since = current.Since
+	r.rewards[reward.ID] = reward
+	return nil
+}
+
+// DeleteReward removes a reward from the catalog
+func (r MemoryRewardRepositoryImpl) DeleteReward(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rewards[id]; !ok {
+		return util.ErrRewardNotFound
+	}
+	delete(r.rewards, id)
+	return nil
+}
+
+// TakeStock decrements the stock of the reward by one only if it's currently available
+func (r MemoryRewardRepositoryImpl) TakeStock(ctx context.Context, id string) (model.Reward, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reward, ok := r.rewards[id]
+	if !ok {
+		return model.Reward{}, util.ErrRewardNotFound
+	}
+	if !reward.IsAvailable(time.Now()) {
+		return model.Reward{}, util.ErrRewardUnavailable
+	}
+
+	reward.Stock--
+	r.rewards[id] = reward
+	return reward, nil
+}
+
+// ReturnStock increments the stock of the reward by one
+func (r MemoryRewardRepositoryImpl) ReturnStock(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reward, ok := r.rewards[id]
+	if !ok {
+		return util.ErrRewardNotFound
+	}
+
+	reward.Stock++
+	r.rewards[id] = reward
+	return nil
+}
+
+// GetRedemptions returns the redemptions of a user, newest first
+func (r MemoryRewardRepositoryImpl) GetRedemptions(ctx context.Context, userID string) ([]model.Redemption, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	redemptions := []model.Redemption{}
+	for _, redemption := range r.redemptions {
+		if redemption.UserID == userID {
+			redemptions = append(redemptions, redemption)
+		}
+	}
+	sort.SliceStable(redemptions, func(i, j int) bool { return redemptions[i].Since.After(redemptions[j].Since) })
+	return redemptions, nil
+}
+
+// GetRedemption finds a redemption by its id
+func (r MemoryRewardRepositoryImpl) GetRedemption(ctx context.Context, id string) (model.Redemption, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	redemption, ok := r.redemptions[id]
+	if !ok {
+		return model.Redemption{}, util.ErrRedemptionNotFound
+	}
+	return redemption, nil
+}
+
+// CreateRedemption stores a redemption and returns it with its new id
+func (r MemoryRewardRepositoryImpl) CreateRedemption(ctx context.Context, redemption model.Redemption) (model.Redemption, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	redemption.ID = primitive.NewObjectID().Hex()
+	r.redemptions[redemption.ID] = redemption
+	return redemption, nil
+}
+
+// UpdateRedemptionStatus moves a redemption from one status to another, only
+// if it's still in the from status
+func (r MemoryRewardRepositoryImpl) UpdateRedemptionStatus(ctx context.Context, id string, from model.RedemptionStatus, to model.RedemptionStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	redemption, ok := r.redemptions[id]
+	if !ok {
+		return util.ErrRedemptionNotFound
+	}
+	if redemption.Status != from {
+		return util.ErrInvalidStatusTransition
+	}
+
+	redemption.Status = to
+	redemption.UpdatedAt = time.Now()
+	r.redemptions[id] = redemption
+	return nil
+}
+
+// DeleteRedemptions removes every redemption of a user
+func (r MemoryRewardRepositoryImpl) DeleteRedemptions(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, redemption := range r.redemptions {
+		if redemption.UserID == userID {
+			delete(r.redemptions, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// MemoryUserRepositoryImpl is a UserRepository that keeps the users in memory.
+// It behaves like UserRepositoryImpl so it can replace it in tests and local runs
+type MemoryUserRepositoryImpl struct {
+	mu    *sync.RWMutex
+	users map[string]model.User
+}
+
+func MemoryUserRepositoryInit() *MemoryUserRepositoryImpl {
+	return &MemoryUserRepositoryImpl{mu: &sync.RWMutex{}, users: map[string]model.User{}}
+}
+
+// FindOne finds the user that matches the query and returns it
+func (r MemoryUserRepositoryImpl) FindOne(ctx context.Context, query UserQuery) (model.User, error) {
+	if query.IsEmpty() {
+		return model.User{}, util.ErrEmptyQuery
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if query.Matches(user) {
+			return user, nil
+		}
+	}
+	return model.User{}, util.ErrUserNotFound
+}
+
+// FindByID finds the user with the given id
+func (r MemoryUserRepositoryImpl) FindByID(ctx context.Context, id string) (model.User, error) {
+	return r.FindOne(ctx, UserQuery{ID: id})
+}
+
+// FindByUsername finds the user with the given username
+func (r MemoryUserRepositoryImpl) FindByUsername(ctx context.Context, username string) (model.User, error) {
+	return r.FindOne(ctx, UserQuery{Username: username})
+}
+
+// FindByEmail finds the user with the given email
+func (r MemoryUserRepositoryImpl) FindByEmail(ctx context.Context, email string) (model.User, error) {
+	return r.FindOne(ctx, UserQuery{Email: email})
+}
+
+// FindByToken finds the user who owns the token
+func (r MemoryUserRepositoryImpl) FindByToken(ctx context.Context, token string) (model.User, error) {
+	return r.FindOne(ctx, UserQuery{Token: token})
+}
+
+// CreateUser stores a new user and returns it with its newly generated id. Usernames and emails
+// are unique ignoring case, users without email don't collide
+func (r MemoryUserRepositoryImpl) CreateUser(ctx context.Context, user model.User) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		// Deleted users keep their username and email until purged
+		if strings.EqualFold(u.Username, user.Username) ||
+			(user.Email != "" && strings.EqualFold(u.Email, user.Email)) {
+			return model.User{}, util.ErrUserAlreadyExists
+		}
+	}
+
+	user.ID = primitive.NewObjectID().Hex()
+	r.users[user.ID] = user
+	return user, nil
+}
+
+// UpdateUser updates the token of the user who owns the token. Like
+// UserRepositoryImpl, an empty token is not written
+func (r MemoryUserRepositoryImpl) UpdateUser(ctx context.Context, token string, updateReq request.Update) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.findByToken(token)
+	if !ok {
+		return util.ErrUserNotFound
+	}
+
+	if updateReq.Token != "" {
+		user.Token = updateReq.Token
+	}
+	r.users[user.ID] = user
+	return nil
+}
+
+// DeleteUser soft deletes the user who owns the token and clears its token
+func (r MemoryUserRepositoryImpl) DeleteUser(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.findByToken(token)
+	if !ok {
+		return util.ErrUserNotFound
+	}
+
+	now := time.Now()
+	user.DeletedAt = &now
+	user.Token = ""
+	r.users[user.ID] = user
+	return nil
+}
+
+// AddPoints adds points to the user with the given id. Negative points are
+// subtracted only if the user has enough of them
+func (r MemoryUserRepositoryImpl) AddPoints(ctx context.Context, id string, points int32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	ok = ok && user.DeletedAt == nil
+	if points < 0 && (!ok || user.Points < -points) {
+		return util.ErrNotEnoughPoints
+	}
+	if !ok {
+		return util.ErrUserNotFound
+	}
+
+	user.Points += points
+	r.users[id] = user
+	return nil
+}
+
+// RestoreUser undoes the soft delete of the user with the given id and gives it a new token
+func (r MemoryUserRepositoryImpl) RestoreUser(ctx context.Context, id string, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return util.ErrUserNotFound
+	}
+
+	user.DeletedAt = nil
+	user.Token = token
+	r.users[id] = user
+	return nil
+}
+
+// FindDeletedBefore returns the users soft deleted before the given time
+func (r MemoryUserRepositoryImpl) FindDeletedBefore(ctx context.Context, before time.Time) ([]model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []model.User{}
+	for _, user := range r.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(before) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// PurgeUser permanently removes the soft deleted user with the given id
+func (r MemoryUserRepositoryImpl) PurgeUser(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return util.ErrUserNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// findByToken returns the not deleted user who owns the token. The caller must hold the lock
+func (r MemoryUserRepositoryImpl) findByToken(token string) (model.User, bool) {
+	for _, user := range r.users {
+		if user.DeletedAt == nil && user.Token == token {
+			return user, true
+		}
+	}
+	return model.User{}, false
+}
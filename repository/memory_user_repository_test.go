@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/repository/repositorytest"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	repositorytest.TestUserRepository(t, func(t *testing.T) repository.UserRepository {
+		return repository.MemoryUserRepositoryInit()
+	})
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// MemoryWebhookRepositoryImpl is a WebhookRepository that keeps the subscriptions
+// and deliveries in memory. It behaves like WebhookRepositoryImpl
+type MemoryWebhookRepositoryImpl struct {
+	mu            *sync.RWMutex
+	subscriptions map[string]model.WebhookSubscription
+	deliveries    map[string]model.WebhookDelivery
+}
+
+func MemoryWebhookRepositoryInit() *MemoryWebhookRepositoryImpl {
+	return &MemoryWebhookRepositoryImpl{
+		mu:            &sync.RWMutex{},
+		subscriptions: map[string]model.WebhookSubscription{},
+		deliveries:    map[string]model.WebhookDelivery{},
+	}
+}
+
+// GetSubscriptions returns every webhook subscription, oldest first
+func (r MemoryWebhookRepositoryImpl) GetSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	return r.findSubscriptions(func(model.WebhookSubscription) bool { return true }), nil
+}
+
+// GetSubscription finds a subscription by its id
+func (r MemoryWebhookRepositoryImpl) GetSubscription(ctx context.Context, id string) (model.WebhookSubscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subscription, ok := r.subscriptions[id]
+	if !ok {
+		return model.WebhookSubscription{}, util.ErrWebhookNotFound
+	}
+	return subscription, nil
+}
+
+// FindSubscriptionsFor returns the active subscriptions that want the event type
+func (r MemoryWebhookRepositoryImpl) FindSubscriptionsFor(ctx context.Context, eventType model.DomainEventType) ([]model.WebhookSubscription, error) {
+	return r.findSubscriptions(func(subscription model.WebhookSubscription) bool {
+		return subscription.Active && subscription.Wants(eventType)
+	}), nil
+}
+
+// CreateSubscription stores a new subscription and returns it with its new id
+func (r MemoryWebhookRepositoryImpl) CreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (model.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscription.ID = primitive.NewObjectID().Hex()
+	r.subscriptions[subscription.ID] = subscription
+	return subscription, nil
+}
+
+// UpdateSubscription replaces every editable field of the subscription with the same id
+func (r MemoryWebhookRepositoryImpl) UpdateSubscription(ctx context.Context, subscription model.WebhookSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.subscriptions[subscription.ID]
+	if !ok {
+		return util.ErrWebhookNotFound
+	}
+
+	stored.URL = subscription.URL
+	stored.EventTypes = subscription.EventTypes
+	stored.Secret = subscription.Secret
+	stored.Active = subscription.Active
+	r.subscriptions[stored.ID] = stored
+	return nil
+}
+
+// DeleteSubscription removes the subscription and its delivery logs
+func (r MemoryWebhookRepositoryImpl) DeleteSubscription(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subscriptions[id]; !ok {
+		return util.ErrWebhookNotFound
+	}
+	delete(r.subscriptions, id)
+	for deliveryID, delivery := range r.deliveries {
+		if delivery.SubscriptionID == id {
+			delete(r.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+// CreateDeliveries stores pending deliveries, skipping the events already
+// queued for the same subscription
+func (r MemoryWebhookRepositoryImpl) CreateDeliveries(ctx context.Context, deliveries ...model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		if r.hasDelivery(delivery.SubscriptionID, delivery.EventID) {
+			continue
+		}
+		delivery.ID = primitive.NewObjectID().Hex()
+		r.deliveries[delivery.ID] = delivery
+	}
+	return nil
+}
+
+// GetDeliveries returns a page of the deliveries that match the query, newest
+// first, and how many deliveries match in total
+func (r MemoryWebhookRepositoryImpl) GetDeliveries(ctx context.Context, query WebhookDeliveryQuery) ([]model.WebhookDelivery, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matching := []model.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if query.Matches(delivery) {
+			matching = append(matching, delivery)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].CreatedAt.After(matching[j].CreatedAt) })
+
+	total := int64(len(matching))
+	start := min(query.Offset, total)
+	end := total
+	if query.Limit > 0 {
+		end = min(start+query.Limit, total)
+	}
+	return matching[start:end], total, nil
+}
+
+// GetDelivery finds a delivery by its id
+func (r MemoryWebhookRepositoryImpl) GetDelivery(ctx context.Context, id string) (model.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return model.WebhookDelivery{}, util.ErrWebhookDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+// ClaimNextDelivery takes the oldest pending delivery due and locks it for the lease
+func (r MemoryWebhookRepositoryImpl) ClaimNextDelivery(ctx context.Context, lease time.Duration) (model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var next model.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.Status != model.WebhookDeliveryPending || delivery.NextAttemptAt.After(now) || delivery.LockedUntil.After(now) {
+			continue
+		}
+		if next.ID == "" || delivery.NextAttemptAt.Before(next.NextAttemptAt) {
+			next = delivery
+		}
+	}
+	if next.ID == "" {
+		return model.WebhookDelivery{}, util.ErrNoWebhookDue
+	}
+
+	next.LockedUntil = now.Add(lease)
+	r.deliveries[next.ID] = next
+	return next, nil
+}
+
+// RecordAttempt appends the attempt to the delivery log, moves the delivery to
+// the given status and unlocks it
+func (r MemoryWebhookRepositoryImpl) RecordAttempt(ctx context.Context, id string, attempt model.WebhookAttempt, status model.WebhookDeliveryStatus, nextAttemptAt time.Time) error {
+	return r.updateDelivery(id, func(delivery *model.WebhookDelivery) {
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		delivery.Status = status
+		delivery.NextAttemptAt = nextAttemptAt
+		delivery.LockedUntil = time.Time{}
+		if status == model.WebhookDeliveryDelivered {
+			deliveredAt := attempt.Time
+			delivery.DeliveredAt = &deliveredAt
+		} else {
+			delivery.Tries++
+		}
+	})
+}
+
+// ReplayDelivery queues the delivery to be sent again right away, whatever its status
+func (r MemoryWebhookRepositoryImpl) ReplayDelivery(ctx context.Context, id string) error {
+	return r.updateDelivery(id, func(delivery *model.WebhookDelivery) {
+		delivery.Status = model.WebhookDeliveryPending
+		delivery.Tries = 0
+		delivery.NextAttemptAt = time.Now()
+		delivery.LockedUntil = time.Time{}
+		delivery.DeliveredAt = nil
+	})
+}
+
+// findSubscriptions returns the subscriptions accepted by keep, oldest first
+func (r MemoryWebhookRepositoryImpl) findSubscriptions(keep func(model.WebhookSubscription) bool) []model.WebhookSubscription {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subscriptions := []model.WebhookSubscription{}
+	for _, subscription := range r.subscriptions {
+		if keep(subscription) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].Since.Before(subscriptions[j].Since) })
+	return subscriptions
+}
+
+// hasDelivery reports if the event is already queued for the subscription. The
+// caller must hold the lock
+func (r MemoryWebhookRepositoryImpl) hasDelivery(subscriptionID string, eventID string) bool {
+	for _, delivery := range r.deliveries {
+		if delivery.SubscriptionID == subscriptionID && delivery.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// updateDelivery applies fn to the delivery with the given id
+func (r MemoryWebhookRepositoryImpl) updateDelivery(id string, fn func(delivery *model.WebhookDelivery)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return util.ErrWebhookDeliveryNotFound
+	}
+	fn(&delivery)
+	r.deliveries[id] = delivery
+	return nil
+}
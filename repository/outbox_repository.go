@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type OutboxRepository interface {
+	AddEvents(ctx context.Context, events ...model.DomainEvent) error
+	ClaimNext(ctx context.Context, lease time.Duration) (model.DomainEvent, error)
+	MarkDelivered(ctx context.Context, id string, sink string) error
+	MarkDispatched(ctx context.Context, id string) error
+	MarkRetry(ctx context.Context, id string, nextAttemptAt time.Time, lastError string, failed bool) error
+}
+
+type OutboxRepositoryImpl struct {
+	db               *mongo.Database
+	outboxCollection *mongo.Collection
+}
+
+func OutboxRepositoryInit(db *mongo.Database) *OutboxRepositoryImpl {
+	return &OutboxRepositoryImpl{db: db, outboxCollection: db.Collection("outbox")}
+}
+
+// AddEvents stores pending events in the outbox. Call it inside the transaction
+// of the change that caused the events
+func (r OutboxRepositoryImpl) AddEvents(ctx context.Context, events ...model.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		event.ID = ""
+		documents = append(documents, event)
+	}
+	_, err := r.outboxCollection.InsertMany(ctx, documents)
+	return err
+}
+
+// ClaimNext takes the oldest pending event due for delivery and locks it for the
+// lease so other dispatchers skip it. The attempt is counted when claiming, so
+// an event whose dispatcher dies is retried after the lease expires
+func (r OutboxRepositoryImpl) ClaimNext(ctx context.Context, lease time.Duration) (model.DomainEvent, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status":          model.DomainEventPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"locked_until":    bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"locked_until": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var result model.DomainEvent
+	if err := r.outboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.DomainEvent{}, util.ErrOutboxEmpty
+		}
+		return model.DomainEvent{}, err
+	}
+	return result, nil
+}
+
+// MarkDelivered records that the event reached the named sink, so it's not
+// delivered there again when retrying the other sinks
+func (r OutboxRepositoryImpl) MarkDelivered(ctx context.Context, id string, sink string) error {
+	return r.update(ctx, id, bson.M{"$addToSet": bson.M{"delivered_to": sink}})
+}
+
+// MarkDispatched records that the event reached every sink
+func (r OutboxRepositoryImpl) MarkDispatched(ctx context.Context, id string) error {
+	return r.update(ctx, id, bson.M{"$set": bson.M{
+		"status":        model.DomainEventDispatched,
+		"dispatched_at": time.Now(),
+		"locked_until":  time.Time{},
+	}})
+}
+
+// MarkRetry unlocks the event so it's retried at nextAttemptAt, or marks it as
+// failed if it ran out of attempts
+func (r OutboxRepositoryImpl) MarkRetry(ctx context.Context, id string, nextAttemptAt time.Time, lastError string, failed bool) error {
+	status := model.DomainEventPending
+	if failed {
+		status = model.DomainEventFailed
+	}
+	return r.update(ctx, id, bson.M{"$set": bson.M{
+		"status":          status,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+		"locked_until":    time.Time{},
+	}})
+}
+
+// update applies the update to the event with the given id
+func (r OutboxRepositoryImpl) update(ctx context.Context, id string, update bson.M) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrDomainEventNotFound
+	}
+
+	result, err := r.outboxCollection.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return util.ErrDomainEventNotFound
+	}
+	return nil
+}
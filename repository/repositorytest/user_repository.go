@@ -0,0 +1,400 @@
+// Package repositorytest holds the contract every repository implementation must
+// fulfill, so the mongo and the in memory repositories behave the same way.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// TestUserRepository runs the UserRepository contract. newRepo must return an
+// empty repository every time it's called. Mongo repositories need a fresh
+// database with repository.Indexes ensured
+func TestUserRepository(t *testing.T, newRepo func(t *testing.T) repository.UserRepository) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repository.UserRepository)
+	}{
+		{"CreateAndGetByFilter", testCreateAndGet},
+		{"FindByTypedMethods", testFindBy},
+		{"GetUnknownUser", testGetUnknown},
+		{"EmptyQuery", testEmptyQuery},
+		{"DuplicateUsername", testDuplicateUsername},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"DuplicateIgnoringCase", testDuplicateIgnoringCase},
+		{"FindIgnoringCase", testFindIgnoringCase},
+		{"UsersWithoutEmail", testUsersWithoutEmail},
+		{"UpdateUser", testUpdate},
+		{"UpdateUnknownUser", testUpdateUnknown},
+		{"DeleteUser", testDelete},
+		{"DeleteUnknownUser", testDeleteUnknown},
+		{"SoftDeleteHidesUser", testSoftDeleteHides},
+		{"RestoreUser", testRestore},
+		{"PurgeUser", testPurge},
+		{"AddPoints", testAddPoints},
+		{"AddPointsNotEnough", testAddPointsNotEnough},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+// NewUser returns a valid user with unique username, email and token derived from name
+func NewUser(name string) model.User {
+	return model.User{
+		Username: name,
+		Password: "hashed-" + name,
+		Name:     "User " + name,
+		Email:    name + "@example.com",
+		Role:     "user",
+		Token:    "token-" + name,
+		LastSeen: time.Now().UTC().Truncate(time.Millisecond),
+		Since:    time.Now().UTC().Truncate(time.Millisecond),
+		Points:   500,
+	}
+}
+
+func testCreateAndGet(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	want := NewUser("alice")
+	mustCreate(t, repo, want)
+
+	for _, query := range []repository.UserQuery{
+		{Username: want.Username},
+		{Email: want.Email},
+		{Token: want.Token},
+		{Username: want.Username, Token: want.Token},
+	} {
+		got, err := repo.FindOne(ctx, query)
+		if err != nil {
+			t.Fatalf("FindOne(%+v) error = %v", query, err)
+		}
+		if got.ID == "" {
+			t.Errorf("FindOne(%+v) returned a user without id", query)
+		}
+		got.ID = ""
+		if got != want {
+			t.Errorf("FindOne(%+v) = %+v, want %+v", query, got, want)
+		}
+	}
+
+	_, err := repo.FindOne(ctx, repository.UserQuery{Username: want.Username, Token: "other"})
+	if !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("FindOne with a partially matching query error = %v, want %v", err, util.ErrUserNotFound)
+	}
+}
+
+func testFindBy(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	want := NewUser("alice")
+	mustCreate(t, repo, want)
+	mustCreate(t, repo, NewUser("bob"))
+	want.ID = mustFind(t, repo, repository.UserQuery{Token: want.Token}).ID
+
+	finders := map[string]func() (model.User, error){
+		"FindByID":       func() (model.User, error) { return repo.FindByID(ctx, want.ID) },
+		"FindByUsername": func() (model.User, error) { return repo.FindByUsername(ctx, want.Username) },
+		"FindByEmail":    func() (model.User, error) { return repo.FindByEmail(ctx, want.Email) },
+		"FindByToken":    func() (model.User, error) { return repo.FindByToken(ctx, want.Token) },
+	}
+	for name, find := range finders {
+		got, err := find()
+		if err != nil {
+			t.Fatalf("%s error = %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func testGetUnknown(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	mustCreate(t, repo, NewUser("alice"))
+
+	finders := map[string]func() (model.User, error){
+		"FindByID":          func() (model.User, error) { return repo.FindByID(ctx, "000000000000000000000000") },
+		"FindByMalformedID": func() (model.User, error) { return repo.FindByID(ctx, "not-an-id") },
+		"FindByUsername":    func() (model.User, error) { return repo.FindByUsername(ctx, "nobody") },
+		"FindByEmail":       func() (model.User, error) { return repo.FindByEmail(ctx, "nobody@example.com") },
+		"FindByToken":       func() (model.User, error) { return repo.FindByToken(ctx, "unknown") },
+	}
+	for name, find := range finders {
+		if _, err := find(); !errors.Is(err, util.ErrUserNotFound) {
+			t.Errorf("%s error = %v, want %v", name, err, util.ErrUserNotFound)
+		}
+	}
+}
+
+func testEmptyQuery(t *testing.T, repo repository.UserRepository) {
+	mustCreate(t, repo, NewUser("alice"))
+
+	_, err := repo.FindOne(context.Background(), repository.UserQuery{})
+	if !errors.Is(err, util.ErrEmptyQuery) {
+		t.Errorf("FindOne error = %v, want %v", err, util.ErrEmptyQuery)
+	}
+}
+
+func testDuplicateUsername(t *testing.T, repo repository.UserRepository) {
+	mustCreate(t, repo, NewUser("alice"))
+
+	duplicate := NewUser("bob")
+	duplicate.Username = "alice"
+	_, err := repo.CreateUser(context.Background(), duplicate)
+	if !errors.Is(err, util.ErrUserAlreadyExists) {
+		t.Errorf("CreateUser error = %v, want %v", err, util.ErrUserAlreadyExists)
+	}
+}
+
+func testDuplicateEmail(t *testing.T, repo repository.UserRepository) {
+	mustCreate(t, repo, NewUser("alice"))
+
+	duplicate := NewUser("bob")
+	duplicate.Email = "alice@example.com"
+	_, err := repo.CreateUser(context.Background(), duplicate)
+	if !errors.Is(err, util.ErrUserAlreadyExists) {
+		t.Errorf("CreateUser error = %v, want %v", err, util.ErrUserAlreadyExists)
+	}
+}
+
+func testDuplicateIgnoringCase(t *testing.T, repo repository.UserRepository) {
+	mustCreate(t, repo, NewUser("alice"))
+
+	duplicate := NewUser("bob")
+	duplicate.Username = "ALICE"
+	if _, err := repo.CreateUser(context.Background(), duplicate); !errors.Is(err, util.ErrUserAlreadyExists) {
+		t.Errorf("CreateUser(username) error = %v, want %v", err, util.ErrUserAlreadyExists)
+	}
+
+	duplicate = NewUser("carol")
+	duplicate.Email = "Alice@Example.com"
+	if _, err := repo.CreateUser(context.Background(), duplicate); !errors.Is(err, util.ErrUserAlreadyExists) {
+		t.Errorf("CreateUser(email) error = %v, want %v", err, util.ErrUserAlreadyExists)
+	}
+}
+
+func testFindIgnoringCase(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	mustCreate(t, repo, NewUser("alice"))
+
+	if _, err := repo.FindByUsername(ctx, "Alice"); err != nil {
+		t.Errorf("FindByUsername error = %v", err)
+	}
+	if _, err := repo.FindByEmail(ctx, "ALICE@example.com"); err != nil {
+		t.Errorf("FindByEmail error = %v", err)
+	}
+}
+
+func testUsersWithoutEmail(t *testing.T, repo repository.UserRepository) {
+	alice, bob := NewUser("alice"), NewUser("bob")
+	alice.Email, bob.Email = "", ""
+	mustCreate(t, repo, alice)
+	mustCreate(t, repo, bob)
+}
+
+func testUpdate(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := NewUser("alice")
+	mustCreate(t, repo, user)
+
+	if err := repo.UpdateUser(ctx, user.Token, request.Update{Token: "new-token"}); err != nil {
+		t.Fatalf("UpdateUser(token) error = %v", err)
+	}
+
+	got := mustFind(t, repo, repository.UserQuery{Token: "new-token"})
+	if got.Username != user.Username || got.Points != user.Points {
+		t.Errorf("FindOne(new token) = %+v, want %s with its points", got, user.Username)
+	}
+
+	_, err := repo.FindByToken(ctx, user.Token)
+	if !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("FindByToken with the old token error = %v, want %v", err, util.ErrUserNotFound)
+	}
+}
+
+func testUpdateUnknown(t *testing.T, repo repository.UserRepository) {
+	err := repo.UpdateUser(context.Background(), "unknown", request.Update{Token: "new-token"})
+	if !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("UpdateUser error = %v, want %v", err, util.ErrUserNotFound)
+	}
+}
+
+func testDelete(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := NewUser("alice")
+	mustCreate(t, repo, user)
+
+	if err := repo.DeleteUser(ctx, user.Token); err != nil {
+		t.Fatalf("DeleteUser error = %v", err)
+	}
+
+	_, err := repo.FindByUsername(ctx, user.Username)
+	if !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("FindByUsername after delete error = %v, want %v", err, util.ErrUserNotFound)
+	}
+
+	// Deleting twice with the same token fails, it's not valid anymore
+	if err := repo.DeleteUser(ctx, user.Token); !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("DeleteUser twice error = %v, want %v", err, util.ErrUserNotFound)
+	}
+}
+
+func testSoftDeleteHides(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := NewUser("alice")
+	mustCreate(t, repo, user)
+	id := mustFind(t, repo, repository.UserQuery{Token: user.Token}).ID
+
+	if err := repo.DeleteUser(ctx, user.Token); err != nil {
+		t.Fatalf("DeleteUser error = %v", err)
+	}
+
+	if _, err := repo.FindByID(ctx, id); !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("FindByID error = %v, want %v", err, util.ErrUserNotFound)
+	}
+	if err := repo.UpdateUser(ctx, user.Token, request.Update{Token: "new-token"}); !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("UpdateUser error = %v, want %v", err, util.ErrUserNotFound)
+	}
+	if err := repo.AddPoints(ctx, id, 1); !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("AddPoints error = %v, want %v", err, util.ErrUserNotFound)
+	}
+
+	deleted := mustFind(t, repo, repository.UserQuery{Username: user.Username, Deleted: true})
+	if deleted.ID != id || deleted.DeletedAt == nil {
+		t.Errorf("FindOne(deleted) = %+v, want the deleted user", deleted)
+	}
+
+	// Until purged the username and email are still taken
+	if _, err := repo.CreateUser(ctx, user); !errors.Is(err, util.ErrUserAlreadyExists) {
+		t.Errorf("CreateUser error = %v, want %v", err, util.ErrUserAlreadyExists)
+	}
+}
+
+func testRestore(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := NewUser("alice")
+	mustCreate(t, repo, user)
+	id := mustFind(t, repo, repository.UserQuery{Token: user.Token}).ID
+
+	if err := repo.RestoreUser(ctx, id, "new-token"); !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("RestoreUser not deleted error = %v, want %v", err, util.ErrUserNotFound)
+	}
+
+	if err := repo.DeleteUser(ctx, user.Token); err != nil {
+		t.Fatalf("DeleteUser error = %v", err)
+	}
+	if err := repo.RestoreUser(ctx, id, "new-token"); err != nil {
+		t.Fatalf("RestoreUser error = %v", err)
+	}
+
+	got := mustFind(t, repo, repository.UserQuery{Token: "new-token"})
+	if got.ID != id || got.DeletedAt != nil {
+		t.Errorf("FindByToken after restore = %+v, want the restored user", got)
+	}
+}
+
+func testPurge(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	alice, bob := NewUser("alice"), NewUser("bob")
+	mustCreate(t, repo, alice)
+	mustCreate(t, repo, bob)
+	aliceID := mustFind(t, repo, repository.UserQuery{Token: alice.Token}).ID
+	bobID := mustFind(t, repo, repository.UserQuery{Token: bob.Token}).ID
+
+	if err := repo.PurgeUser(ctx, bobID); !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("PurgeUser not deleted error = %v, want %v", err, util.ErrUserNotFound)
+	}
+
+	if err := repo.DeleteUser(ctx, alice.Token); err != nil {
+		t.Fatalf("DeleteUser error = %v", err)
+	}
+
+	before, err := repo.FindDeletedBefore(ctx, time.Now().Add(-time.Hour))
+	if err != nil || len(before) != 0 {
+		t.Errorf("FindDeletedBefore(an hour ago) = %v, %v, want no users", before, err)
+	}
+
+	expired, err := repo.FindDeletedBefore(ctx, time.Now().Add(time.Second))
+	if err != nil || len(expired) != 1 || expired[0].ID != aliceID {
+		t.Fatalf("FindDeletedBefore(now) = %v, %v, want alice", expired, err)
+	}
+
+	if err := repo.PurgeUser(ctx, aliceID); err != nil {
+		t.Fatalf("PurgeUser error = %v", err)
+	}
+
+	// Once purged the username is free again
+	mustCreate(t, repo, alice)
+}
+
+func testDeleteUnknown(t *testing.T, repo repository.UserRepository) {
+	err := repo.DeleteUser(context.Background(), "unknown")
+	if !errors.Is(err, util.ErrUserNotFound) {
+		t.Errorf("DeleteUser error = %v, want %v", err, util.ErrUserNotFound)
+	}
+}
+
+func testAddPoints(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := NewUser("alice")
+	mustCreate(t, repo, user)
+	id := mustFind(t, repo, repository.UserQuery{Token: user.Token}).ID
+
+	if err := repo.AddPoints(ctx, id, 100); err != nil {
+		t.Fatalf("AddPoints(100) error = %v", err)
+	}
+	if err := repo.AddPoints(ctx, id, -600); err != nil {
+		t.Fatalf("AddPoints(-600) error = %v", err)
+	}
+
+	if got := mustFind(t, repo, repository.UserQuery{Token: user.Token}).Points; got != 0 {
+		t.Errorf("points = %d, want 0", got)
+	}
+}
+
+func testAddPointsNotEnough(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := NewUser("alice")
+	mustCreate(t, repo, user)
+	id := mustFind(t, repo, repository.UserQuery{Token: user.Token}).ID
+
+	err := repo.AddPoints(ctx, id, -501)
+	if !errors.Is(err, util.ErrNotEnoughPoints) {
+		t.Errorf("AddPoints error = %v, want %v", err, util.ErrNotEnoughPoints)
+	}
+
+	if got := mustFind(t, repo, repository.UserQuery{Token: user.Token}).Points; got != user.Points {
+		t.Errorf("points = %d, want %d", got, user.Points)
+	}
+}
+
+func mustCreate(t *testing.T, repo repository.UserRepository, user model.User) model.User {
+	t.Helper()
+	created, err := repo.CreateUser(context.Background(), user)
+	if err != nil {
+		t.Fatalf("CreateUser(%s) error = %v", user.Username, err)
+	}
+	if created.ID == "" {
+		t.Fatalf("CreateUser(%s) returned a user without id", user.Username)
+	}
+	return created
+}
+
+func mustFind(t *testing.T, repo repository.UserRepository, query repository.UserQuery) model.User {
+	t.Helper()
+	user, err := repo.FindOne(context.Background(), query)
+	if err != nil {
+		t.Fatalf("FindOne(%+v) error = %v", query, err)
+	}
+	return user
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type RewardRepository interface {
+	GetRewards(ctx context.Context, onlyAvailable bool) ([]model.Reward, error)
+	GetReward(ctx context.Context, id string) (model.Reward, error)
+	CreateReward(ctx context.Context, reward model.Reward) (model.Reward, error)
+	UpdateReward(ctx context.Context, reward model.Reward) error
+	DeleteReward(ctx context.Context, id string) error
+	TakeStock(ctx context.Context, id string) (model.Reward, error)
+	ReturnStock(ctx context.Context, id string) error
+	GetRedemptions(ctx context.Context, userID string) ([]model.Redemption, error)
+	GetRedemption(ctx context.Context, id string) (model.Redemption, error)
+	CreateRedemption(ctx context.Context, redemption model.Redemption) (model.Redemption, error)
+	UpdateRedemptionStatus(ctx context.Context, id string, from model.RedemptionStatus, to model.RedemptionStatus) error
+	DeleteRedemptions(ctx context.Context, userID string) error
+}
+
+type RewardRepositoryImpl struct {
+	db                   *mongo.Database
+	rewardCollection     *mongo.Collection
+	redemptionCollection *mongo.Collection
+}
+
+func RewardRepositoryInit(db *mongo.Database) *RewardRepositoryImpl {
+	return &RewardRepositoryImpl{
+		db:                   db,
+		rewardCollection:     db.Collection("rewards"),
+		redemptionCollection: db.Collection("redemptions"),
+	}
+}
+
+// GetRewards returns the reward catalog. If onlyAvailable is set only the rewards
+// in stock and inside their availability window are returned
+func (r RewardRepositoryImpl) GetRewards(ctx context.Context, onlyAvailable bool) ([]model.Reward, error) {
+	filter := bson.M{}
+	if onlyAvailable {
+		filter = availableFilter(time.Now())
+	}
+
+	cursor, err := r.rewardCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "cost", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	rewards := []model.Reward{}
+	if err := cursor.All(ctx, &rewards); err != nil {
+		return nil, err
+	}
+	return rewards, nil
+}
+
+// GetReward finds a reward by its id
+func (r RewardRepositoryImpl) GetReward(ctx context.Context, id string) (model.Reward, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Reward{}, util.ErrRewardNotFound
+	}
+
+	var result model.Reward
+	if err := r.rewardCollection.FindOne(ctx, bson.M{"_id": oid}).Decode(&result); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.Reward{}, util.ErrRewardNotFound
+		}
+		return model.Reward{}, err
+	}
+	return result, nil
+}
+
+// CreateReward inserts a new reward in the catalog and returns it with its new id
+func (r RewardRepositoryImpl) CreateReward(ctx context.Context, reward model.Reward) (model.Reward, error) {
+	reward.ID = ""
+	result, err := r.rewardCollection.InsertOne(ctx, reward)
+	if err != nil {
+		return model.Reward{}, err
+	}
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		reward.ID = oid.Hex()
+	}
+	return reward, nil
+}
+
+// UpdateReward replaces every editable field of the reward with the same id
+func (r RewardRepositoryImpl) UpdateReward(ctx context.Context, reward model.Reward) error {
+	oid, err := primitive.ObjectIDFromHex(reward.ID)
+	if err != nil {
+		return util.ErrRewardNotFound
+	}
+
+	in := bson.M{
+		"name":            reward.Name,
+		"description":     reward.Description,
+		"cost":            reward.Cost,
+		"stock":           reward.Stock,
+		"available_from":  reward.AvailableFrom,
+		"available_until": reward.AvailableUntil,
+	}
+
+	result, err := r.rewardCollection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": in})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return util.ErrRewardNotFound
+	}
+	return nil
+}
+
+// DeleteReward removes a reward from the catalog. Redemptions already made are kept
+func (r RewardRepositoryImpl) DeleteReward(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrRewardNotFound
+	}
+
+	result, err := r.rewardCollection.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return util.ErrRewardNotFound
+	}
+	return nil
+}
+
+// TakeStock decrements the stock of the reward by one only if it's currently
+// available. The check and the decrement happen in a single update so two
+// concurrent redemptions can't take the last unit. Returns the updated reward
+func (r RewardRepositoryImpl) TakeStock(ctx context.Context, id string) (model.Reward, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Reward{}, util.ErrRewardNotFound
+	}
+
+	filter := availableFilter(time.Now())
+	filter["_id"] = oid
+
+	var result model.Reward
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.rewardCollection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"stock": -1}}, opts).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Telling apart a missing reward from one that can't be redeemed
+			if _, err := r.GetReward(ctx, id); err != nil {
+				return model.Reward{}, err
+			}
+			return model.Reward{}, util.ErrRewardUnavailable
+		}
+		return model.Reward{}, err
+	}
+	return result, nil
+}
+
+// ReturnStock increments the stock of the reward by one
+func (r RewardRepositoryImpl) ReturnStock(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrRewardNotFound
+	}
+
+	result, err := r.rewardCollection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$inc": bson.M{"stock": 1}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return util.ErrRewardNotFound
+	}
+	return nil
+}
+
+// GetRedemptions returns the redemptions of a user, newest first
+func (r RewardRepositoryImpl) GetRedemptions(ctx context.Context, userID string) ([]model.Redemption, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "since", Value: -1}})
+	cursor, err := r.redemptionCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	redemptions := []model.Redemption{}
+	if err := cursor.All(ctx, &redemptions); err != nil {
+		return nil, err
+	}
+	return redemptions, nil
+}
+
+// GetRedemption finds a redemption by its id
+func (r RewardRepositoryImpl) GetRedemption(ctx context.Context, id string) (model.Redemption, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Redemption{}, util.ErrRedemptionNotFound
+	}
+
+	var result model.Redemption
+	if err := r.redemptionCollection.FindOne(ctx, bson.M{"_id": oid}).Decode(&result); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.Redemption{}, util.ErrRedemptionNotFound
+		}
+		return model.Redemption{}, err
+	}
+	return result, nil
+}
+
+// CreateRedemption inserts a redemption and returns it with its new id
+func (r RewardRepositoryImpl) CreateRedemption(ctx context.Context, redemption model.Redemption) (model.Redemption, error) {
+	redemption.ID = ""
+	result, err := r.redemptionCollection.InsertOne(ctx, redemption)
+	if err != nil {
+		return model.Redemption{}, err
+	}
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		redemption.ID = oid.Hex()
+	}
+	return redemption, nil
+}
+
+// UpdateRedemptionStatus moves a redemption from one status to another. The
+// update only matches if the redemption is still in the from status, so a
+// redemption can't be cancelled (and refunded) twice
+func (r RewardRepositoryImpl) UpdateRedemptionStatus(ctx context.Context, id string, from model.RedemptionStatus, to model.RedemptionStatus) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrRedemptionNotFound
+	}
+
+	filter := bson.M{"_id": oid, "status": from}
+	update := bson.M{"$set": bson.M{"status": to, "updated_at": time.Now()}}
+	result, err := r.redemptionCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return util.ErrInvalidStatusTransition
+	}
+	return nil
+}
+
+// DeleteRedemptions removes every redemption of a user
+func (r RewardRepositoryImpl) DeleteRedemptions(ctx context.Context, userID string) error {
+	_, err := r.redemptionCollection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// availableFilter matches the rewards with stock left and inside their availability
+// window at the given time. Zero dates leave that side of the window open
+func availableFilter(at time.Time) bson.M {
+	return bson.M{
+		"stock":          bson.M{"$gt": 0},
+		"available_from": bson.M{"$lte": at},
+		"$or": bson.A{
+			bson.M{"available_until": time.Time{}},
+			bson.M{"available_until": bson.M{"$gt": at}},
+		},
+	}
+}
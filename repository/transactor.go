@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs functions whose repository calls must succeed or fail together
+type Transactor interface {
+	// WithTransaction runs fn in a transaction. Repositories must be called with
+	// the ctx fn receives. Calls nested in a running transaction join it
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// TransactorImpl runs mongo transactions. Transactions need a replica set or
+// a sharded cluster, on a standalone server fn runs without a transaction
+type TransactorImpl struct {
+	client    *mongo.Client
+	supported bool
+}
+
+func TransactorInit(db *mongo.Database) *TransactorImpl {
+	supported := supportsTransactions(db)
+	if !supported {
+		slog.Warn("MongoDB is a standalone server, writes that should be atomic will run without transactions")
+	}
+	return &TransactorImpl{client: db.Client(), supported: supported}
+}
+
+// WithTransaction runs fn in a transaction, retrying it on transient errors
+func (t TransactorImpl) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !t.supported || mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	return t.client.UseSession(ctx, func(sessCtx mongo.SessionContext) error {
+		_, err := sessCtx.WithTransaction(sessCtx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sessCtx)
+		})
+		return err
+	})
+}
+
+// WithoutTransaction returns ctx detached from the transaction running in it,
+// if any. Writes made with it are committed on their own, so they are kept
+// when the transaction rolls back and their errors don't abort it
+func WithoutTransaction(ctx context.Context) context.Context {
+	if mongo.SessionFromContext(ctx) == nil {
+		return ctx
+	}
+	return withoutSession{ctx}
+}
+
+// withoutSession hides the mongo session stored in the context it wraps
+type withoutSession struct {
+	context.Context
+}
+
+func (c withoutSession) Value(key any) any {
+	value := c.Context.Value(key)
+	if _, ok := value.(mongo.Session); ok {
+		return nil
+	}
+	return value
+}
+
+// supportsTransactions asks the server if it's part of a replica set or a sharded cluster
+func supportsTransactions(db *mongo.Database) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := db.Client().Database("admin").RunCommand(context.TODO(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	return err == nil && (hello.SetName != "" || hello.Msg == "isdbgrid")
+}
+
+// NoTransactor runs functions directly, for storages without transactions
+type NoTransactor struct{}
+
+// WithTransaction runs fn
+func (NoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// UserChangeStreamImpl streams the changes of a user with a mongo change stream
+// on the users collection, so it sees the writes of every instance of the app.
+// The update ids are the resume tokens of the change stream
+type UserChangeStreamImpl struct {
+	userCollection *mongo.Collection
+}
+
+func UserChangeStreamInit(db *mongo.Database) *UserChangeStreamImpl {
+	return &UserChangeStreamImpl{userCollection: db.Collection("users")}
+}
+
+// SupportsChangeStreams reports if the server can stream changes. Like
+// transactions, change streams need a replica set or a sharded cluster
+func SupportsChangeStreams(db *mongo.Database) bool {
+	return supportsTransactions(db)
+}
+
+// userChange is the part of a change stream event the feed reads
+type userChange struct {
+	ResumeToken       bson.Raw   `bson:"_id"`
+	FullDocument      model.User `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// Subscribe watches the user document. If lastEventID is a resume token that
+// the server still has, the stream resumes right after it
+func (r UserChangeStreamImpl) Subscribe(ctx context.Context, userID string, lastEventID string) (<-chan model.UserUpdate, bool, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, false, util.ErrUserNotFound
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"documentKey._id": oid,
+		"operationType":   bson.M{"$in": bson.A{"update", "replace"}},
+	}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+
+	resumed := false
+	var stream *mongo.ChangeStream
+	if lastEventID != "" {
+		stream, err = r.userCollection.Watch(ctx, pipeline, opts.SetResumeAfter(bson.M{"_data": lastEventID}))
+		resumed = err == nil
+	}
+	if stream == nil {
+		stream, err = r.userCollection.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	updates := make(chan model.UserUpdate)
+	go func() {
+		defer close(updates)
+		defer stream.Close(context.Background())
+
+		for stream.Next(ctx) {
+			var change userChange
+			if err := stream.Decode(&change); err != nil {
+				logging.FromContext(ctx).Error("Error decoding user change", "error", err)
+				return
+			}
+
+			update, ok := userUpdateOf(change)
+			if !ok {
+				continue
+			}
+			select {
+			case updates <- update:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).Error("Error streaming user changes", "error", err)
+		}
+	}()
+	return updates, resumed, nil
+}
+
+// userUpdateOf turns a change of the user document into an update. Changes of
+// fields the user doesn't see, like the token, are skipped
+func userUpdateOf(change userChange) (model.UserUpdate, bool) {
+	id, _ := change.ResumeToken.Lookup("_data").StringValueOK()
+	fields := change.UpdateDescription.UpdatedFields
+	if id == "" || change.FullDocument.ID == "" {
+		// The user was purged before its change could be looked up
+		return model.UserUpdate{}, false
+	}
+
+	switch {
+	case change.FullDocument.DeletedAt != nil:
+		if _, deleted := fields["deleted_at"]; !deleted && fields != nil {
+			return model.UserUpdate{}, false
+		}
+		return model.NewUserUpdate(id, model.UserDeletedUpdate, model.User{ID: change.FullDocument.ID}), true
+	case fields == nil:
+		return model.NewUserUpdate(id, model.UserProfileUpdate, change.FullDocument), true
+	}
+
+	if _, ok := fields["points"]; ok {
+		return model.NewUserUpdate(id, model.UserPointsUpdate, change.FullDocument), true
+	}
+	for field := range fields {
+		if field != "token" && field != "last_seen" {
+			return model.NewUserUpdate(id, model.UserProfileUpdate, change.FullDocument), true
+		}
+	}
+	return model.UserUpdate{}, false
+}
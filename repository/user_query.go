@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"strings"
+
+	"ignaciofp.es/web-service-portfolio/model"
+)
+
+// UserQuery describes the user to look for independently of the storage. Every
+// non empty field must match, empty fields are ignored. Usernames and emails
+// are compared ignoring case, like the unique indexes do
+type UserQuery struct {
+	ID       string
+	Username string
+	Email    string
+	Token    string
+	// Deleted makes the query match only soft deleted users. Otherwise they
+	// never match
+	Deleted bool
+}
+
+// IsEmpty reports if the query has no criteria identifying a user
+func (q UserQuery) IsEmpty() bool {
+	return q.ID == "" && q.Username == "" && q.Email == "" && q.Token == ""
+}
+
+// Matches reports if the user meets every criteria of the query
+func (q UserQuery) Matches(user model.User) bool {
+	return q.Deleted == (user.DeletedAt != nil) &&
+		(q.ID == "" || q.ID == user.ID) &&
+		(q.Username == "" || strings.EqualFold(q.Username, user.Username)) &&
+		(q.Email == "" || strings.EqualFold(q.Email, user.Email)) &&
+		(q.Token == "" || q.Token == user.Token)
+}
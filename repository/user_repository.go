@@ -3,19 +3,30 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"ignaciofp.es/web-service-portfolio/model"
 	"ignaciofp.es/web-service-portfolio/model/request"
 	"ignaciofp.es/web-service-portfolio/util"
 )
 
 type UserRepository interface {
-	GetUser(ctx context.Context, filter bson.D) (model.User, error)
-	CreateUser(ctx context.Context, user model.User) error
+	FindOne(ctx context.Context, query UserQuery) (model.User, error)
+	FindByID(ctx context.Context, id string) (model.User, error)
+	FindByUsername(ctx context.Context, username string) (model.User, error)
+	FindByEmail(ctx context.Context, email string) (model.User, error)
+	FindByToken(ctx context.Context, token string) (model.User, error)
+	CreateUser(ctx context.Context, user model.User) (model.User, error)
 	UpdateUser(ctx context.Context, token string, updateReq request.Update) error
 	DeleteUser(ctx context.Context, token string) error
+	AddPoints(ctx context.Context, id string, points int32) error
+	RestoreUser(ctx context.Context, id string, token string) error
+	FindDeletedBefore(ctx context.Context, before time.Time) ([]model.User, error)
+	PurgeUser(ctx context.Context, id string) error
 }
 
 type UserRepositoryImpl struct {
@@ -27,10 +38,39 @@ func UserRepositoryInit(db *mongo.Database) *UserRepositoryImpl {
 	return &UserRepositoryImpl{db: db, userCollection: db.Collection("users")}
 }
 
-// GetUser finds a user in the database using the specified filter and returns it
-func (r UserRepositoryImpl) GetUser(ctx context.Context, filter bson.D) (model.User, error) {
+// FindOne finds the user that matches the query and returns it
+func (r UserRepositoryImpl) FindOne(ctx context.Context, query UserQuery) (model.User, error) {
+	if query.IsEmpty() {
+		return model.User{}, util.ErrEmptyQuery
+	}
+
+	filter := bson.D{}
+	if query.ID != "" {
+		oid, err := primitive.ObjectIDFromHex(query.ID)
+		if err != nil {
+			return model.User{}, util.ErrUserNotFound
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: oid})
+	}
+	if query.Username != "" {
+		filter = append(filter, bson.E{Key: "username", Value: query.Username})
+	}
+	if query.Email != "" {
+		filter = append(filter, bson.E{Key: "email", Value: query.Email})
+	}
+	if query.Token != "" {
+		filter = append(filter, bson.E{Key: "token", Value: query.Token})
+	}
+	filter = append(filter, bson.E{Key: "deleted_at", Value: bson.M{"$exists": query.Deleted}})
+
+	// Only using the collation when needed, the token index doesn't have it
+	opts := options.FindOne()
+	if query.Username != "" || query.Email != "" {
+		opts.SetCollation(caseInsensitive)
+	}
+
 	var result model.User
-	if err := r.userCollection.FindOne(ctx, filter).Decode(&result); err != nil {
+	if err := r.userCollection.FindOne(ctx, filter, opts).Decode(&result); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return model.User{}, util.ErrUserNotFound
 		}
@@ -39,36 +79,50 @@ func (r UserRepositoryImpl) GetUser(ctx context.Context, filter bson.D) (model.U
 	return result, nil
 }
 
-// CreateUser creates a new user in the database
-func (r UserRepositoryImpl) CreateUser(ctx context.Context, user model.User) error {
-	_, err := r.userCollection.InsertOne(ctx, user)
+// FindByID finds the user with the given id
+func (r UserRepositoryImpl) FindByID(ctx context.Context, id string) (model.User, error) {
+	return r.FindOne(ctx, UserQuery{ID: id})
+}
+
+// FindByUsername finds the user with the given username
+func (r UserRepositoryImpl) FindByUsername(ctx context.Context, username string) (model.User, error) {
+	return r.FindOne(ctx, UserQuery{Username: username})
+}
+
+// FindByEmail finds the user with the given email
+func (r UserRepositoryImpl) FindByEmail(ctx context.Context, email string) (model.User, error) {
+	return r.FindOne(ctx, UserQuery{Email: email})
+}
+
+// FindByToken finds the user who owns the token
+func (r UserRepositoryImpl) FindByToken(ctx context.Context, token string) (model.User, error) {
+	return r.FindOne(ctx, UserQuery{Token: token})
+}
+
+// CreateUser creates a new user in the database and returns it with its new id
+func (r UserRepositoryImpl) CreateUser(ctx context.Context, user model.User) (model.User, error) {
+	user.ID = ""
+	result, err := r.userCollection.InsertOne(ctx, user)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
-			return util.ErrUserAlreadyExists
+			return model.User{}, util.ErrUserAlreadyExists
 		}
-		return err
+		return model.User{}, err
 	}
-	return nil
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		user.ID = oid.Hex()
+	}
+	return user, nil
 }
 
-// UpdateUser updates a user in the database and returns it. Only accepts updates to points or token
+// UpdateUser updates a user in the database. Only accepts updates to the token
 func (r UserRepositoryImpl) UpdateUser(ctx context.Context, token string, updateReq request.Update) error {
-	// Ugly temporary hack
-	// When using struct directly it updates
-	// both the token and the points
-	// Doing this workaround avoids that
-	// but not the best.
-	// Error: when specifically setting points to 0
-	// doesn't update them
 	in := bson.M{}
-	if updateReq.Points != 0 {
-		in["points"] = updateReq.Points
-	}
 	if updateReq.Token != "" {
 		in["token"] = updateReq.Token
 	}
 
-	result, err := r.userCollection.UpdateOne(ctx, bson.M{"token": token}, bson.M{"$set": in})
+	result, err := r.userCollection.UpdateOne(ctx, notDeleted(bson.M{"token": token}), bson.M{"$set": in})
 	if err != nil {
 		return err
 	}
@@ -79,9 +133,95 @@ func (r UserRepositoryImpl) UpdateUser(ctx context.Context, token string, update
 	return nil
 }
 
-// DeleteUser deletes a user in the database
+// DeleteUser soft deletes the user who owns the token. The user is kept until
+// purged but it's hidden from every query and its token stops being valid
 func (r UserRepositoryImpl) DeleteUser(ctx context.Context, token string) error {
-	result, err := r.userCollection.DeleteOne(ctx, bson.M{"token": token})
+	update := bson.M{
+		"$set":   bson.M{"deleted_at": time.Now()},
+		"$unset": bson.M{"token": ""},
+	}
+
+	result, err := r.userCollection.UpdateOne(ctx, notDeleted(bson.M{"token": token}), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return util.ErrUserNotFound
+	}
+	return nil
+}
+
+// AddPoints adds points to the user with the given id. Negative points are
+// subtracted only if the user has enough of them, in a single update
+func (r UserRepositoryImpl) AddPoints(ctx context.Context, id string, points int32) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrUserNotFound
+	}
+
+	filter := notDeleted(bson.M{"_id": oid})
+	if points < 0 {
+		filter["points"] = bson.M{"$gte": -points}
+	}
+
+	result, err := r.userCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"points": points}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if points < 0 {
+			return util.ErrNotEnoughPoints
+		}
+		return util.ErrUserNotFound
+	}
+	return nil
+}
+
+// RestoreUser undoes the soft delete of the user with the given id and gives it a new token
+func (r UserRepositoryImpl) RestoreUser(ctx context.Context, id string, token string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrUserNotFound
+	}
+
+	filter := bson.M{"_id": oid, "deleted_at": bson.M{"$exists": true}}
+	update := bson.M{
+		"$set":   bson.M{"token": token},
+		"$unset": bson.M{"deleted_at": ""},
+	}
+
+	result, err := r.userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return util.ErrUserNotFound
+	}
+	return nil
+}
+
+// FindDeletedBefore returns the users soft deleted before the given time
+func (r UserRepositoryImpl) FindDeletedBefore(ctx context.Context, before time.Time) ([]model.User, error) {
+	cursor, err := r.userCollection.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		return nil, err
+	}
+
+	users := []model.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// PurgeUser permanently removes the soft deleted user with the given id
+func (r UserRepositoryImpl) PurgeUser(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrUserNotFound
+	}
+
+	result, err := r.userCollection.DeleteOne(ctx, bson.M{"_id": oid, "deleted_at": bson.M{"$exists": true}})
 	if err != nil {
 		return err
 	}
@@ -90,3 +230,9 @@ func (r UserRepositoryImpl) DeleteUser(ctx context.Context, token string) error
 	}
 	return nil
 }
+
+// notDeleted adds to the filter the condition to skip soft deleted users
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
@@ -0,0 +1,48 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/repository/repositorytest"
+)
+
+// TestUserRepository runs the contract against MongoDB, every subtest in a
+// database of its own that is dropped afterwards. It's skipped unless
+// MONGO_TEST_URI points to a server
+func TestUserRepository(t *testing.T) {
+	client := mongoClient(t)
+	ctx := context.Background()
+
+	repositorytest.TestUserRepository(t, func(t *testing.T) repository.UserRepository {
+		db := client.Database(fmt.Sprintf("test_%d", time.Now().UnixNano()))
+		t.Cleanup(func() { db.Drop(context.Background()) })
+		if _, err := repository.EnsureIndexes(ctx, db, repository.Indexes); err != nil {
+			t.Fatalf("EnsureIndexes error = %v", err)
+		}
+		return repository.UserRepositoryInit(db)
+	})
+}
+
+// mongoClient connects to the server of MONGO_TEST_URI, or skips the test if
+// it's not set
+func mongoClient(t *testing.T) *mongo.Client {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("Connect error = %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	return client
+}
@@ -0,0 +1,18 @@
+package repository
+
+import "ignaciofp.es/web-service-portfolio/model"
+
+// WebhookDeliveryQuery filters and paginates the deliveries of a subscription
+// independently of the storage. An empty status matches every delivery
+type WebhookDeliveryQuery struct {
+	SubscriptionID string
+	Status         model.WebhookDeliveryStatus
+	Offset         int64
+	Limit          int64
+}
+
+// Matches reports if the delivery meets every filter of the query
+func (q WebhookDeliveryQuery) Matches(delivery model.WebhookDelivery) bool {
+	return q.SubscriptionID == delivery.SubscriptionID &&
+		(q.Status == "" || q.Status == delivery.Status)
+}
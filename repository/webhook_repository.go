@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type WebhookRepository interface {
+	GetSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (model.WebhookSubscription, error)
+	FindSubscriptionsFor(ctx context.Context, eventType model.DomainEventType) ([]model.WebhookSubscription, error)
+	CreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (model.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, subscription model.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+	CreateDeliveries(ctx context.Context, deliveries ...model.WebhookDelivery) error
+	GetDeliveries(ctx context.Context, query WebhookDeliveryQuery) ([]model.WebhookDelivery, int64, error)
+	GetDelivery(ctx context.Context, id string) (model.WebhookDelivery, error)
+	ClaimNextDelivery(ctx context.Context, lease time.Duration) (model.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, id string, attempt model.WebhookAttempt, status model.WebhookDeliveryStatus, nextAttemptAt time.Time) error
+	ReplayDelivery(ctx context.Context, id string) error
+}
+
+type WebhookRepositoryImpl struct {
+	db                     *mongo.Database
+	subscriptionCollection *mongo.Collection
+	deliveryCollection     *mongo.Collection
+}
+
+func WebhookRepositoryInit(db *mongo.Database) *WebhookRepositoryImpl {
+	return &WebhookRepositoryImpl{
+		db:                     db,
+		subscriptionCollection: db.Collection("webhook_subscriptions"),
+		deliveryCollection:     db.Collection("webhook_deliveries"),
+	}
+}
+
+// GetSubscriptions returns every webhook subscription, oldest first
+func (r WebhookRepositoryImpl) GetSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	return r.findSubscriptions(ctx, bson.M{})
+}
+
+// GetSubscription finds a subscription by its id
+func (r WebhookRepositoryImpl) GetSubscription(ctx context.Context, id string) (model.WebhookSubscription, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.WebhookSubscription{}, util.ErrWebhookNotFound
+	}
+
+	var result model.WebhookSubscription
+	if err := r.subscriptionCollection.FindOne(ctx, bson.M{"_id": oid}).Decode(&result); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.WebhookSubscription{}, util.ErrWebhookNotFound
+		}
+		return model.WebhookSubscription{}, err
+	}
+	return result, nil
+}
+
+// FindSubscriptionsFor returns the active subscriptions that want the event type
+func (r WebhookRepositoryImpl) FindSubscriptionsFor(ctx context.Context, eventType model.DomainEventType) ([]model.WebhookSubscription, error) {
+	return r.findSubscriptions(ctx, bson.M{"active": true, "event_types": eventType})
+}
+
+// CreateSubscription inserts a new subscription and returns it with its new id
+func (r WebhookRepositoryImpl) CreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (model.WebhookSubscription, error) {
+	subscription.ID = ""
+	result, err := r.subscriptionCollection.InsertOne(ctx, subscription)
+	if err != nil {
+		return model.WebhookSubscription{}, err
+	}
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		subscription.ID = oid.Hex()
+	}
+	return subscription, nil
+}
+
+// UpdateSubscription replaces every editable field of the subscription with the same id
+func (r WebhookRepositoryImpl) UpdateSubscription(ctx context.Context, subscription model.WebhookSubscription) error {
+	oid, err := primitive.ObjectIDFromHex(subscription.ID)
+	if err != nil {
+		return util.ErrWebhookNotFound
+	}
+
+	in := bson.M{
+		"url":         subscription.URL,
+		"event_types": subscription.EventTypes,
+		"secret":      subscription.Secret,
+		"active":      subscription.Active,
+	}
+
+	result, err := r.subscriptionCollection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": in})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return util.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// DeleteSubscription removes the subscription and its delivery logs
+func (r WebhookRepositoryImpl) DeleteSubscription(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrWebhookNotFound
+	}
+
+	result, err := r.subscriptionCollection.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return util.ErrWebhookNotFound
+	}
+
+	_, err = r.deliveryCollection.DeleteMany(ctx, bson.M{"subscription_id": id})
+	return err
+}
+
+// CreateDeliveries stores pending deliveries. A delivery of an event already
+// queued for the same subscription is skipped, so the sink can be retried safely
+func (r WebhookRepositoryImpl) CreateDeliveries(ctx context.Context, deliveries ...model.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		delivery.ID = ""
+		documents = append(documents, delivery)
+	}
+	_, err := r.deliveryCollection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err != nil && !isOnlyDuplicateKeyErrors(err) {
+		return err
+	}
+	return nil
+}
+
+// GetDeliveries returns a page of the deliveries that match the query, newest
+// first, and how many deliveries match in total
+func (r WebhookRepositoryImpl) GetDeliveries(ctx context.Context, query WebhookDeliveryQuery) ([]model.WebhookDelivery, int64, error) {
+	filter := bson.M{"subscription_id": query.SubscriptionID}
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+
+	total, err := r.deliveryCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(query.Offset)
+	if query.Limit > 0 {
+		opts.SetLimit(query.Limit)
+	}
+	cursor, err := r.deliveryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	deliveries := []model.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+// GetDelivery finds a delivery by its id
+func (r WebhookRepositoryImpl) GetDelivery(ctx context.Context, id string) (model.WebhookDelivery, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.WebhookDelivery{}, util.ErrWebhookDeliveryNotFound
+	}
+
+	var result model.WebhookDelivery
+	if err := r.deliveryCollection.FindOne(ctx, bson.M{"_id": oid}).Decode(&result); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.WebhookDelivery{}, util.ErrWebhookDeliveryNotFound
+		}
+		return model.WebhookDelivery{}, err
+	}
+	return result, nil
+}
+
+// ClaimNextDelivery takes the oldest pending delivery due and locks it for the
+// lease so other workers skip it. Returns ErrNoWebhookDue if there is none
+func (r WebhookRepositoryImpl) ClaimNextDelivery(ctx context.Context, lease time.Duration) (model.WebhookDelivery, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status":          model.WebhookDeliveryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"locked_until":    bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var result model.WebhookDelivery
+	if err := r.deliveryCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.WebhookDelivery{}, util.ErrNoWebhookDue
+		}
+		return model.WebhookDelivery{}, err
+	}
+	return result, nil
+}
+
+// RecordAttempt appends the attempt to the delivery log, moves the delivery to
+// the given status and unlocks it. Pending deliveries are retried at nextAttemptAt
+func (r WebhookRepositoryImpl) RecordAttempt(ctx context.Context, id string, attempt model.WebhookAttempt, status model.WebhookDeliveryStatus, nextAttemptAt time.Time) error {
+	set := bson.M{
+		"status":          status,
+		"next_attempt_at": nextAttemptAt,
+		"locked_until":    time.Time{},
+	}
+	update := bson.M{"$set": set, "$push": bson.M{"attempts": attempt}}
+	if status == model.WebhookDeliveryDelivered {
+		set["delivered_at"] = attempt.Time
+	} else {
+		update["$inc"] = bson.M{"tries": 1}
+	}
+	return r.updateDelivery(ctx, id, update)
+}
+
+// ReplayDelivery queues the delivery to be sent again right away with all its
+// tries, whatever its status. The log of the previous attempts is kept
+func (r WebhookRepositoryImpl) ReplayDelivery(ctx context.Context, id string) error {
+	return r.updateDelivery(ctx, id, bson.M{
+		"$set": bson.M{
+			"status":          model.WebhookDeliveryPending,
+			"tries":           0,
+			"next_attempt_at": time.Now(),
+			"locked_until":    time.Time{},
+		},
+		"$unset": bson.M{"delivered_at": ""},
+	})
+}
+
+// findSubscriptions returns the subscriptions that match the filter, oldest first
+func (r WebhookRepositoryImpl) findSubscriptions(ctx context.Context, filter bson.M) ([]model.WebhookSubscription, error) {
+	cursor, err := r.subscriptionCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "since", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []model.WebhookSubscription{}
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// updateDelivery applies the update to the delivery with the given id
+func (r WebhookRepositoryImpl) updateDelivery(ctx context.Context, id string, update bson.M) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return util.ErrWebhookDeliveryNotFound
+	}
+
+	result, err := r.deliveryCollection.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return util.ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// isOnlyDuplicateKeyErrors reports if every document of a bulk write failed
+// because of a duplicate key
+func isOnlyDuplicateKeyErrors(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
@@ -1,52 +1,194 @@
 package router
 
 import (
-	"github.com/gin-contrib/cors"
+	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 	"ignaciofp.es/web-service-portfolio/config"
+	"ignaciofp.es/web-service-portfolio/docs"
+	"ignaciofp.es/web-service-portfolio/middleware"
+	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/tracing"
+	"ignaciofp.es/web-service-portfolio/util"
 )
 
+// authBodyLimit is the largest body of the auth routes, in bytes
+const authBodyLimit = 4 << 10
+
+// Handler serves the router trimming the trailing slash of the paths first,
+// so /users/ is routed as /users without redirecting the client
+func Handler(router *gin.Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) > 1 && strings.HasSuffix(r.URL.Path, "/") {
+			r = r.Clone(r.Context())
+			r.URL.Path = strings.TrimRight(r.URL.Path, "/")
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			r.URL.RawPath = ""
+		}
+		router.ServeHTTP(w, r)
+	})
+}
+
+// VersionedRoutes drops the routes without version prefix that alias a v1
+// route, they are documented through it
+func VersionedRoutes(routes gin.RoutesInfo) gin.RoutesInfo {
+	v1 := map[string]bool{}
+	for _, route := range routes {
+		v1[route.Method+" "+route.Path] = true
+	}
+
+	var versioned gin.RoutesInfo
+	for _, route := range routes {
+		if !v1[route.Method+" /v1"+route.Path] {
+			versioned = append(versioned, route)
+		}
+	}
+	return versioned
+}
+
 // Init initializes a gin router with routes and controllers
 func Init(init *config.Initialization) *gin.Engine {
-	router := gin.Default()
+	router := gin.New()
+
+	// Request bodies are checked against the rules in their binding tags
+	// and fields the requests don't have are rejected
+	binding.EnableDecoderDisallowUnknownFields = true
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := request.RegisterValidations(v); err != nil {
+			panic(err)
+		}
+	}
+
+	// Letting the gin context used as context.Context in the services
+	// reach the values of the request context
+	router.ContextWithFallback = true
+
+	// Redirects break CORS preflights, trailing slashes are trimmed by
+	// Handler before routing instead. Paths served with another method
+	// are answered with 405 and OPTIONS with the allowed methods
+	router.RedirectTrailingSlash = false
+	router.RedirectFixedPath = false
+	router.HandleMethodNotAllowed = true
+
+	// The client address is resolved by middleware.RequestInfo with the
+	// configured trusted proxies, gin's own resolution trusts every proxy
+	router.ForwardedByClientIP = false
+	if err := router.SetTrustedProxies(nil); err != nil {
+		panic(err)
+	}
+
+	// Admin routes get their own, stricter, CORS policy
+	cors, err := middleware.CORS(init.CORS.API, map[string]middleware.CORSPolicy{
+		"/v1/admin": init.CORS.Admin,
+		"/admin":    init.CORS.Admin,
+	})
+	if err != nil {
+		panic(err)
+	}
 
-	// Default config:
-	// - No origin allowed by default
-	// - GET, POST, PUT, HEAD methods
-	// - Credentials share disabled
-	// - Preflight requests cached for 12 hours
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowHeaders = append(config.AllowHeaders, "Token")
-	config.AllowMethods = append(config.AllowMethods, "OPTIONS")
+	router.Use(init.Metrics.Middleware())
+	router.Use(tracing.Middleware())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.RequestInfo(init.Proxies))
+	router.Use(middleware.RequestLogger())
+	router.Use(middleware.Recovery())
+	router.Use(middleware.Errors())
+	router.Use(cors)
+	router.Use(middleware.SecurityHeaders(init.Security))
+	router.Use(middleware.LimitBody(init.Security.MaxBodyBytes))
+	router.Use(middleware.RequireJSON())
 
-	router.Use(cors.New(config))
+	// Unknown routes get a problem too
+	router.NoRoute(func(ctx *gin.Context) {
+		ctx.Error(util.ErrRouteNotFound)
+	})
+	router.NoMethod(middleware.MethodNotAllowed(router.Routes))
 
 	router.GET("/ping", init.UserCtrl.Ping)
+	router.GET("/healthz", init.HealthCtrl.Liveness)
+	router.GET("/readyz", init.HealthCtrl.Readiness)
+	router.GET("/openapi.json", docs.SpecHandler())
+	router.GET("/docs", docs.UIHandler())
+	router.GET("/docs/:file", docs.AssetHandler())
 
+	// The API is versioned by path prefix. A version only changes in ways
+	// that don't break its clients, breaking changes go to the next one
+	registerV1(router.Group("/v1"), init)
+	registerV2(router.Group("/v2"), init)
+
+	// Routes without prefix are the ones clients used before versioning,
+	// they are served as v1 with deprecation headers until their sunset
+	registerV1(router.Group("", init.DeprecationMw.Deprecated("/v1")), init)
+
+	return router
+}
+
+// registerV1 maps the routes of the first version of the API
+func registerV1(v1 *gin.RouterGroup, init *config.Initialization) {
 	// Defining groups and int's mappings
-	// Routes are duplicated because a weird error where if the
-	// route for example is /users/ and client sends a request to
-	// /users throws a CORS error.
-	var userGroup *gin.RouterGroup = router.Group("/users")
+	var userGroup *gin.RouterGroup = v1.Group("/users", middleware.NoStore())
 	{
 		userGroup.GET("", init.UserCtrl.GetUser)
 		userGroup.PUT("", init.UserCtrl.UpdateUser)
 		userGroup.DELETE("", init.UserCtrl.DeleteUser)
-		userGroup.GET("/", init.UserCtrl.GetUser)
-		userGroup.PUT("/", init.UserCtrl.UpdateUser)
-		userGroup.DELETE("/", init.UserCtrl.DeleteUser)
+		userGroup.GET("/redemptions", init.RewardCtrl.GetRedemptions)
+		userGroup.GET("/stream", init.UserCtrl.Stream)
 	}
 
-	var authGroup *gin.RouterGroup = router.Group("/auth")
+	// Credentials are small, and the responses carry tokens
+	var authGroup *gin.RouterGroup = v1.Group("/auth", middleware.NoStore(), middleware.LimitBody(authBodyLimit))
 	{
 		authGroup.POST("/login", init.AuthCtrl.Authenticate)
 		authGroup.POST("/register", init.AuthCtrl.Register)
 		authGroup.POST("/logout", init.AuthCtrl.Logout)
-		authGroup.POST("/login/", init.AuthCtrl.Authenticate)
-		authGroup.POST("/register/", init.AuthCtrl.Register)
-		authGroup.POST("/logout/", init.AuthCtrl.Logout)
+		authGroup.POST("/restore", init.AuthCtrl.Restore)
 	}
 
-	return router
+	var rewardGroup *gin.RouterGroup = v1.Group("/rewards")
+	{
+		rewardGroup.GET("", init.RewardCtrl.GetRewards)
+		rewardGroup.GET("/:id", init.RewardCtrl.GetReward)
+		rewardGroup.POST("/:id/redeem", init.RewardCtrl.Redeem)
+	}
+
+	// Every route under /admin needs a token of an admin user, and a client
+	// certificate if a client CA is configured
+	var adminGroup *gin.RouterGroup = v1.Group("/admin")
+	if init.Security.AdminClientCerts {
+		adminGroup.Use(middleware.RequireClientCert())
+	}
+	adminGroup.Use(init.AuthMw.RequireRole("admin"))
+	{
+		adminGroup.GET("/rewards", init.RewardCtrl.GetAllRewards)
+		adminGroup.POST("/rewards", init.RewardCtrl.CreateReward)
+		adminGroup.PUT("/rewards/:id", init.RewardCtrl.UpdateReward)
+		adminGroup.DELETE("/rewards/:id", init.RewardCtrl.DeleteReward)
+		adminGroup.PUT("/redemptions/:id", init.RewardCtrl.UpdateRedemptionStatus)
+		adminGroup.POST("/users/:id/points", init.UserCtrl.AddPoints)
+		adminGroup.GET("/audit", init.AuditCtrl.GetEvents)
+		adminGroup.GET("/audit/verify", init.AuditCtrl.VerifyChain)
+		adminGroup.GET("/webhooks", init.WebhookCtrl.GetSubscriptions)
+		adminGroup.POST("/webhooks", init.WebhookCtrl.CreateSubscription)
+		adminGroup.GET("/webhooks/:id", init.WebhookCtrl.GetSubscription)
+		adminGroup.PUT("/webhooks/:id", init.WebhookCtrl.UpdateSubscription)
+		adminGroup.DELETE("/webhooks/:id", init.WebhookCtrl.DeleteSubscription)
+		adminGroup.GET("/webhooks/:id/deliveries", init.WebhookCtrl.GetDeliveries)
+		adminGroup.POST("/webhooks/:id/deliveries/:delivery/replay", init.WebhookCtrl.ReplayDelivery)
+	}
+}
+
+// registerV2 maps the routes of the second version of the API, where the
+// routes whose request or response shapes change are added. The rest are
+// only served by v1 until they change
+func registerV2(v2 *gin.RouterGroup, init *config.Initialization) {
+	// Users are shown as profiles, with "id" and without the token
+	var userGroup *gin.RouterGroup = v2.Group("/users", middleware.NoStore())
+	{
+		userGroup.GET("", init.UserCtrl.GetProfile)
+	}
 }
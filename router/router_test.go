@@ -0,0 +1,240 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"ignaciofp.es/web-service-portfolio/config"
+	"ignaciofp.es/web-service-portfolio/docs"
+	"ignaciofp.es/web-service-portfolio/router"
+)
+
+// newRouter returns the router of the app with the in memory storage and the
+// settings in the flags of args
+func newRouter(t *testing.T, args ...string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg, _, err := config.Load(append([]string{"-storage", string(config.StorageMemory)}, args...))
+	if err != nil {
+		t.Fatalf("Load error = %v", err)
+	}
+	return router.Init(config.Init(cfg))
+}
+
+// serve sends a request through the handler of the app
+func serve(app *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.Handler(app).ServeHTTP(recorder, req)
+	return recorder
+}
+
+// register signs a user up and returns its token
+func register(t *testing.T, app *gin.Engine) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/register", strings.NewReader(`{"username":"alice","password":"password123","email":"alice@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := serve(app, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("register status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Token == "" {
+		t.Fatalf("register body = %s, %v, want a token", recorder.Body, err)
+	}
+	return body.Token
+}
+
+// TestRoutesAreDocumented fails when a route is missing from openapi.json or
+// an operation of it has no route, like `./app openapi check`
+func TestRoutesAreDocumented(t *testing.T) {
+	app := newRouter(t)
+
+	missing, unrouted, err := docs.Coverage(router.VersionedRoutes(app.Routes()))
+	if err != nil {
+		t.Fatalf("Coverage error = %v", err)
+	}
+	for _, operation := range missing {
+		t.Errorf("Missing from openapi.json: %s", operation)
+	}
+	for _, operation := range unrouted {
+		t.Errorf("No route for: %s", operation)
+	}
+}
+
+func TestDocsUIAssets(t *testing.T) {
+	app := newRouter(t)
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/docs", http.StatusOK, "text/html; charset=utf-8"},
+		{"/docs/swagger-ui-bundle.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"/docs/swagger-initializer.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"/docs/swagger-ui.css", http.StatusOK, "text/css; charset=utf-8"},
+		{"/docs/LICENSE", http.StatusNotFound, "application/problem+json"},
+		{"/docs/missing.js", http.StatusNotFound, "application/problem+json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			recorder := serve(app, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			if got := recorder.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if tt.status == http.StatusOK && recorder.Body.Len() == 0 {
+				t.Errorf("empty body")
+			}
+		})
+	}
+}
+
+func TestVersionsServedSideBySide(t *testing.T) {
+	app := newRouter(t, "-legacy-sunset", "2027-06-30T00:00:00Z")
+	token := register(t, app)
+
+	tests := []struct {
+		path       string
+		fields     []string
+		noFields   []string
+		deprecated bool
+	}{
+		{"/v1/users", []string{"_id", "token", "points"}, []string{"id", "password"}, false},
+		{"/v2/users", []string{"id", "points"}, []string{"_id", "token", "password"}, false},
+		{"/users", []string{"_id", "token", "points"}, []string{"id", "password"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Token", token)
+			recorder := serve(app, req)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, http.StatusOK, recorder.Body)
+			}
+
+			var user map[string]any
+			if err := json.Unmarshal(recorder.Body.Bytes(), &user); err != nil {
+				t.Fatalf("body %s: %v", recorder.Body, err)
+			}
+			if user["username"] != "alice" {
+				t.Errorf("username = %v, want alice", user["username"])
+			}
+			for _, field := range tt.fields {
+				if _, ok := user[field]; !ok {
+					t.Errorf("field %q missing from %s", field, recorder.Body)
+				}
+			}
+			for _, field := range tt.noFields {
+				if _, ok := user[field]; ok {
+					t.Errorf("field %q in %s, want it left out", field, recorder.Body)
+				}
+			}
+
+			header := recorder.Header()
+			if !tt.deprecated {
+				if header.Get("Deprecation") != "" || header.Get("Sunset") != "" {
+					t.Errorf("Deprecation = %q, Sunset = %q, want none", header.Get("Deprecation"), header.Get("Sunset"))
+				}
+				return
+			}
+			if header.Get("Deprecation") != "@1792368000" {
+				t.Errorf("Deprecation = %q, want @1792368000", header.Get("Deprecation"))
+			}
+			if header.Get("Sunset") != "Wed, 30 Jun 2027 00:00:00 GMT" {
+				t.Errorf("Sunset = %q, want Wed, 30 Jun 2027 00:00:00 GMT", header.Get("Sunset"))
+			}
+			if header.Get("Link") != `</v1/users>; rel="successor-version"` {
+				t.Errorf("Link = %q, want the v1 successor", header.Get("Link"))
+			}
+		})
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	app := newRouter(t)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/ping", http.StatusOK},
+		{"/ping/", http.StatusOK},
+		{"/ping//", http.StatusOK},
+		{"/v1/rewards/", http.StatusOK},
+		{"/rewards/", http.StatusOK},
+		{"/", http.StatusNotFound},
+		{"/nope/", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			recorder := serve(app, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			if location := recorder.Header().Get("Location"); location != "" {
+				t.Errorf("Location = %q, want no redirect", location)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	app := newRouter(t)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{http.MethodDelete, "/ping", http.StatusMethodNotAllowed, "GET, OPTIONS"},
+		{http.MethodPost, "/v1/users", http.StatusMethodNotAllowed, "DELETE, GET, OPTIONS, PUT"},
+		{http.MethodPost, "/v1/users/", http.StatusMethodNotAllowed, "DELETE, GET, OPTIONS, PUT"},
+		{http.MethodPatch, "/v1/admin/rewards/42", http.StatusMethodNotAllowed, "DELETE, OPTIONS, PUT"},
+		{http.MethodGet, "/v1/auth/login", http.StatusMethodNotAllowed, "OPTIONS, POST"},
+		{http.MethodOptions, "/v1/users", http.StatusNoContent, "DELETE, GET, OPTIONS, PUT"},
+		{http.MethodOptions, "/v1/users/", http.StatusNoContent, "DELETE, GET, OPTIONS, PUT"},
+		{http.MethodOptions, "/v1/rewards/42/redeem", http.StatusNoContent, "OPTIONS, POST"},
+		{http.MethodOptions, "/nope", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			recorder := serve(app, httptest.NewRequest(tt.method, tt.path, nil))
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if got := recorder.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+
+			switch tt.status {
+			case http.StatusNoContent:
+				if recorder.Body.Len() != 0 {
+					t.Errorf("body = %s, want none", recorder.Body)
+				}
+			case http.StatusMethodNotAllowed:
+				var problem struct {
+					Code    string `json:"code"`
+					Details struct {
+						Allowed []string `json:"allowed"`
+					} `json:"details"`
+				}
+				if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+					t.Fatalf("body %s: %v", recorder.Body, err)
+				}
+				if problem.Code != "method_not_allowed" || strings.Join(problem.Details.Allowed, ", ") != tt.allow {
+					t.Errorf("problem = %+v, want method_not_allowed with the allowed methods", problem)
+				}
+			}
+		})
+	}
+}
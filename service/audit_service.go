@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/tracing"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type AuditService interface {
+	Record(ctx context.Context, event model.AuditEvent)
+	GetEvents(ctx context.Context, query repository.AuditQuery) ([]model.AuditEvent, int64, error)
+	VerifyChain(ctx context.Context) (model.AuditChainStatus, error)
+}
+
+// AuditHashChain enables chaining the audit events with hashes
+type AuditHashChain bool
+
+// maxChainRetries is how many times an event tries to take the next place in
+// the chain when other events are being recorded at the same time
+const maxChainRetries = 10
+
+type AuditServiceImpl struct {
+	repository repository.AuditRepository
+	hashChain  AuditHashChain
+}
+
+func AuditServiceInit(repository repository.AuditRepository, hashChain AuditHashChain) *AuditServiceImpl {
+	return &AuditServiceImpl{repository: repository, hashChain: hashChain}
+}
+
+// Record appends an event to the audit log, completing it with the time and
+// the request info in ctx. Auditing never makes the audited action fail, so
+// errors are only logged. The event is written outside the transaction
+// running in ctx, if any, so it's kept when the transaction rolls back
+func (s AuditServiceImpl) Record(ctx context.Context, event model.AuditEvent) {
+	ctx, span := tracing.Start(repository.WithoutTransaction(ctx), "AuditService.Record")
+	defer span.End()
+
+	info := util.GetRequestInfo(ctx)
+	event.Time = time.Now().UTC().Truncate(time.Millisecond)
+	event.IP = util.ClientIP(ctx)
+	event.UserAgent = info.UserAgent
+	if event.ActorID == "" {
+		event.ActorID = info.ActorID
+	}
+	if event.ActorID == "" {
+		event.ActorID = event.TargetID
+	}
+
+	var err error
+	if s.hashChain {
+		err = s.appendChained(ctx, event)
+	} else {
+		err = s.repository.CreateEvent(ctx, event)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("Error recording audit event", "action", event.Action, "error", err)
+	}
+}
+
+// GetEvents returns a page of the events that match the query and the total of matching events
+func (s AuditServiceImpl) GetEvents(ctx context.Context, query repository.AuditQuery) (_ []model.AuditEvent, _ int64, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.GetEvents")
+	defer tracing.End(span, &err)
+
+	return s.repository.GetEvents(ctx, query)
+}
+
+// VerifyChain walks the chained events in order checking that every event
+// follows the previous one and that its content matches its hash
+func (s AuditServiceImpl) VerifyChain(ctx context.Context) (_ model.AuditChainStatus, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.VerifyChain")
+	defer tracing.End(span, &err)
+
+	const batchSize = 500
+
+	status := model.AuditChainStatus{Valid: true}
+	var prev model.AuditEvent
+	for {
+		events, err := s.repository.GetChain(ctx, prev.Sequence, batchSize)
+		if err != nil {
+			return model.AuditChainStatus{}, err
+		}
+
+		for _, event := range events {
+			reason := ""
+			switch {
+			case event.Sequence != prev.Sequence+1:
+				reason = fmt.Sprintf("expected sequence %d, events are missing", prev.Sequence+1)
+			case event.PrevHash != prev.Hash:
+				reason = "previous hash doesn't match the previous event"
+			case event.Hash != event.ComputeHash():
+				reason = "hash doesn't match the event content"
+			}
+			if reason != "" {
+				status.Valid = false
+				status.BrokenAt = event.Sequence
+				status.Reason = reason
+				return status, nil
+			}
+
+			status.Events++
+			prev = event
+		}
+
+		if len(events) < batchSize {
+			return status, nil
+		}
+	}
+}
+
+// appendChained links the event to the last chained event and appends it. If
+// another event takes the same place first it retries with the new last event
+func (s AuditServiceImpl) appendChained(ctx context.Context, event model.AuditEvent) error {
+	for i := 0; i < maxChainRetries; i++ {
+		last, err := s.repository.GetLastChained(ctx)
+		if err != nil && !errors.Is(err, util.ErrAuditEventNotFound) {
+			return err
+		}
+
+		event.Sequence = last.Sequence + 1
+		event.PrevHash = last.Hash
+		event.Hash = event.ComputeHash()
+
+		err = s.repository.CreateEvent(ctx, event)
+		if !errors.Is(err, util.ErrAuditSequenceTaken) {
+			return err
+		}
+	}
+	return util.ErrAuditSequenceTaken
+}
+
+// auditOutcome returns the outcome and reason of an audited action from its error
+func auditOutcome(err error) (model.AuditOutcome, string) {
+	if err != nil {
+		return model.AuditFailure, err.Error()
+	}
+	return model.AuditSuccess, ""
+}
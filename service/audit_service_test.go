@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+)
+
+func TestRecordOutsideTheTransaction(t *testing.T) {
+	for _, hashChain := range []AuditHashChain{false, true} {
+		audit := newTxAuditRepository()
+		tx := fakeTransactor{audit: audit}
+		service := AuditServiceInit(audit, hashChain)
+		ctx := context.Background()
+
+		rollback := errors.New("rollback")
+		err := tx.WithTransaction(ctx, func(ctx context.Context) error {
+			service.Record(ctx, model.AuditEvent{Action: model.AuditDelete, TargetID: "user-1", Outcome: model.AuditFailure, Reason: "rollback"})
+			return rollback
+		})
+		if !errors.Is(err, rollback) {
+			t.Fatalf("WithTransaction error = %v, want %v", err, rollback)
+		}
+
+		events, total, err := service.GetEvents(ctx, repository.AuditQuery{})
+		if err != nil || total != 1 {
+			t.Fatalf("hash chain %v: GetEvents = %+v, %d, %v, want the event kept after the rollback", hashChain, events, total, err)
+		}
+		if hashChain {
+			status, err := service.VerifyChain(ctx)
+			if err != nil || !status.Valid || status.Events != 1 {
+				t.Errorf("VerifyChain = %+v, %v, want a valid chain of 1 event", status, err)
+			}
+		}
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"encoding/hex"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"golang.org/x/crypto/bcrypt"
+	"ignaciofp.es/web-service-portfolio/metrics"
 	"ignaciofp.es/web-service-portfolio/model"
 	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/tracing"
 	"ignaciofp.es/web-service-portfolio/util"
 )
 
@@ -17,52 +19,77 @@ type AuthService interface {
 	Authenticate(ctx context.Context, authReq request.Auth) (string, error)
 	Register(ctx context.Context, registerReq request.Register) (string, error)
 	Logout(ctx context.Context, token string) error
+	Restore(ctx context.Context, authReq request.Auth) (string, error)
 	assignNewToken(ctx context.Context, oldToken string) (string, error)
 }
 
 type AuthServiceImpl struct {
 	service UserService
+	audit   AuditService
+	tx      repository.Transactor
+	outbox  repository.OutboxRepository
+	metrics *metrics.Metrics
 }
 
-func AuthServiceInit(service UserService) *AuthServiceImpl {
-	return &AuthServiceImpl{service: service}
+func AuthServiceInit(service UserService, audit AuditService, tx repository.Transactor, outbox repository.OutboxRepository, metrics *metrics.Metrics) *AuthServiceImpl {
+	return &AuthServiceImpl{service: service, audit: audit, tx: tx, outbox: outbox, metrics: metrics}
 }
 
 // Authenticate checks if username and password are valid and correct and returns newly
 // generated token. If a token  is provided and is valid generates, updates and returns a new token
 // params: username, password, token
-func (s AuthServiceImpl) Authenticate(ctx context.Context, authReq request.Auth) (string, error) {
+func (s AuthServiceImpl) Authenticate(ctx context.Context, authReq request.Auth) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Authenticate")
+	defer tracing.End(span, &err)
+
 	username := authReq.Username
 	password := authReq.Password
 	token := authReq.Token
 
-	if token != "" {
+	var user model.User
+	var newToken string
+	method := "password"
+	switch {
+	case token != "":
 		// Login with token and username
-		return s.authenticateWithToken(ctx, token)
+		method = "token"
+		user, newToken, err = s.authenticateWithToken(ctx, token)
+	case username == "" || password == "":
+		err = util.ErrNoUsernameOrPasswordProvided
+	default:
+		// Login with username and password
+		user, newToken, err = s.authenticateWithPassword(ctx, username, password)
 	}
+	s.metrics.ObserveLogin(method, err)
 
-	if username == "" || password == "" {
-		return "", util.ErrNoUsernameOrPasswordProvided
+	if user.Username != "" {
+		username = user.Username
 	}
-
-	// Login with username and password
-	return s.authenticateWithPassword(ctx, username, password)
+	outcome, reason := auditOutcome(err)
+	s.audit.Record(ctx, model.AuditEvent{
+		Action:   model.AuditLogin,
+		TargetID: user.ID,
+		Username: username,
+		Outcome:  outcome,
+		Reason:   reason,
+	})
+	return newToken, err
 }
 
 // Register sets all the required data for the user and creates it. then returns a token for auth
-func (s AuthServiceImpl) Register(ctx context.Context, registerReq request.Register) (string, error) {
+func (s AuthServiceImpl) Register(ctx context.Context, registerReq request.Register) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Register")
+	defer tracing.End(span, &err)
+
 	var user model.User
 
 	user.Username = registerReq.Username
 	user.Password = registerReq.Password
 	user.Email = registerReq.Email
 	user.Name = registerReq.Name
-	user.Role = registerReq.Role
 
-	// If no role is specified then assign to normal user
-	if registerReq.Role == "" {
-		user.Role = "user"
-	}
+	// Self registered accounts are always users, admins can't sign themselves up
+	user.Role = "user"
 
 	// Starting points
 	user.Points = 500
@@ -70,8 +97,9 @@ func (s AuthServiceImpl) Register(ctx context.Context, registerReq request.Regis
 	user.Token = generateRandomToken()
 
 	// Hashing password
-	hashPassword, err := hashPassword(user.Password)
+	hashPassword, err := s.hashPassword(ctx, user.Password)
 	if err != nil {
+		s.metrics.ObserveRegistration(err)
 		return "", err
 	}
 	user.Password = hashPassword
@@ -80,7 +108,23 @@ func (s AuthServiceImpl) Register(ctx context.Context, registerReq request.Regis
 	user.Since = time.Now()
 	user.LastSeen = time.Now()
 
-	err = s.service.CreateUser(ctx, user)
+	var created model.User
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if created, err = s.service.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		return s.outbox.AddEvents(ctx, model.NewUserRegistered(created))
+	})
+	s.metrics.ObserveRegistration(err)
+	outcome, reason := auditOutcome(err)
+	s.audit.Record(ctx, model.AuditEvent{
+		Action:   model.AuditRegister,
+		TargetID: created.ID,
+		Username: user.Username,
+		Outcome:  outcome,
+		Reason:   reason,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -88,46 +132,107 @@ func (s AuthServiceImpl) Register(ctx context.Context, registerReq request.Regis
 	return user.Token, nil
 }
 
-func (s AuthServiceImpl) Logout(ctx context.Context, token string) error {
+func (s AuthServiceImpl) Logout(ctx context.Context, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Logout")
+	defer tracing.End(span, &err)
+
 	// Generating another random token and not returning it, so
 	// Previous token isn't valid anymore
 	// If we simply put empty token or for example "invalid_token"
 	// and someone knows that it's so easy for them to do whatever
 	// with that token
-	return s.service.UpdateUser(ctx, token, request.Update{Token: generateRandomToken()})
-}
+	user, err := s.service.GetUserByToken(ctx, token)
+	if err != nil {
+		s.metrics.ObserveLogout(err)
+		return err
+	}
 
-// authenticateWithToken authenticates the user with the provided token and username. Returns a new token
-func (s AuthServiceImpl) authenticateWithToken(ctx context.Context, token string) (string, error) {
-	// When updating the user token it already
-	// ensures that the user exist and the token is valid
-	// therefore no need to run more checks
-	// Generating new token and returning it
-	return s.assignNewToken(ctx, token)
+	err = s.service.UpdateUser(ctx, token, request.Update{Token: generateRandomToken()})
+	s.metrics.ObserveLogout(err)
+	outcome, reason := auditOutcome(err)
+	s.audit.Record(ctx, model.AuditEvent{
+		Action:   model.AuditLogout,
+		TargetID: user.ID,
+		Username: user.Username,
+		Outcome:  outcome,
+		Reason:   reason,
+	})
+	return err
 }
 
-// authenticateWithToken authenticates the user with the provided username and password. Returns a new token
-func (s AuthServiceImpl) authenticateWithPassword(ctx context.Context, username string, password string) (string, error) {
-	// user, err := s.service.GetUserWithPass(ctx, username)
-	// Quick test
+// Restore brings back a deleted account during its grace period. As the token is
+// cleared when deleting, the username and password are required. Returns a new token
+func (s AuthServiceImpl) Restore(ctx context.Context, authReq request.Auth) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Restore")
+	defer tracing.End(span, &err)
 
-	filter := bson.D{
-		{
-			Key: "username", Value: username,
-		},
+	if authReq.Username == "" || authReq.Password == "" {
+		return "", util.ErrNoUsernameOrPasswordProvided
 	}
 
-	user, err := s.service.GetUserByFilter(ctx, filter)
+	user, err := s.service.GetUserByQuery(ctx, repository.UserQuery{Username: authReq.Username, Deleted: true})
 	if err != nil {
 		return "", err
 	}
 
-	if !checkPasswordHash(password, user.Password) {
+	if !s.checkPasswordHash(ctx, authReq.Password, user.Password) {
+		s.audit.Record(ctx, model.AuditEvent{
+			Action:   model.AuditRestore,
+			TargetID: user.ID,
+			Username: user.Username,
+			Outcome:  model.AuditFailure,
+			Reason:   util.ErrInvalidUsernameOrPassword.Error(),
+		})
 		return "", util.ErrInvalidUsernameOrPassword
 	}
 
+	token := generateRandomToken()
+	if err := s.service.RestoreUser(ctx, user, token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// authenticateWithToken authenticates the user with the provided token. Returns the user and a new token
+func (s AuthServiceImpl) authenticateWithToken(ctx context.Context, token string) (model.User, string, error) {
+	user, err := s.service.GetUserByToken(ctx, token)
+	if err != nil {
+		return model.User{}, "", err
+	}
+
 	// Generating new token and returning it
-	return s.assignNewToken(ctx, user.Token)
+	newToken, err := s.loginWithNewToken(ctx, user, token, "token")
+	return user, newToken, err
+}
+
+// authenticateWithPassword authenticates the user with the provided username and password. Returns the user and a new token
+func (s AuthServiceImpl) authenticateWithPassword(ctx context.Context, username string, password string) (model.User, string, error) {
+	user, err := s.service.GetUserByQuery(ctx, repository.UserQuery{Username: username})
+	if err != nil {
+		return model.User{}, "", err
+	}
+
+	if !s.checkPasswordHash(ctx, password, user.Password) {
+		return user, "", util.ErrInvalidUsernameOrPassword
+	}
+
+	// Generating new token and returning it
+	newToken, err := s.loginWithNewToken(ctx, user, user.Token, "password")
+	return user, newToken, err
+}
+
+// loginWithNewToken assigns a new token to the user and publishes the login
+// made with the given method. Returns the new token
+func (s AuthServiceImpl) loginWithNewToken(ctx context.Context, user model.User, oldToken string, method string) (string, error) {
+	var newToken string
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if newToken, err = s.assignNewToken(ctx, oldToken); err != nil {
+			return err
+		}
+		return s.outbox.AddEvents(ctx, model.NewUserLoggedIn(user, method))
+	})
+	return newToken, err
 }
 
 // Creates a new token for the user and updates it, then return the updated token
@@ -144,18 +249,29 @@ func (s AuthServiceImpl) assignNewToken(ctx context.Context, oldToken string) (s
 }
 
 // hashPassword hashes the password provided and returns it
-func hashPassword(password string) (string, error) {
+func (s AuthServiceImpl) hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt.hash")
+	defer span.End()
+	defer s.observeHash("hash", time.Now())
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(bytes), err
 }
 
 // checkPasswordHash takes a password and a hashed password and returns if the hashed
 // password comes from the password
-func checkPasswordHash(password, hash string) bool {
+func (s AuthServiceImpl) checkPasswordHash(ctx context.Context, password, hash string) bool {
+	_, span := tracing.Start(ctx, "bcrypt.compare")
+	defer span.End()
+	defer s.observeHash("compare", time.Now())
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
+// observeHash records the time spent in a bcrypt operation started at start
+func (s AuthServiceImpl) observeHash(operation string, start time.Time) {
+	s.metrics.ObservePasswordHash(operation, time.Since(start))
+}
+
 // generateRandomToken generates a random token and returns it
 func generateRandomToken() string {
 	b := make([]byte, 16)
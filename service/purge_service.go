@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/tracing"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type PurgeService interface {
+	PurgeDeletedUsers(ctx context.Context) (int, error)
+}
+
+type PurgeServiceImpl struct {
+	userRepository   repository.UserRepository
+	rewardRepository repository.RewardRepository
+	gracePeriod      DeleteGracePeriod
+}
+
+func PurgeServiceInit(userRepository repository.UserRepository, rewardRepository repository.RewardRepository, gracePeriod DeleteGracePeriod) *PurgeServiceImpl {
+	return &PurgeServiceImpl{userRepository: userRepository, rewardRepository: rewardRepository, gracePeriod: gracePeriod}
+}
+
+// PurgeDeletedUsers permanently removes the users deleted longer than the grace
+// period ago along with their data. Returns how many users were purged
+func (s PurgeServiceImpl) PurgeDeletedUsers(ctx context.Context) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "PurgeService.PurgeDeletedUsers")
+	defer tracing.End(span, &err)
+
+	users, err := s.userRepository.FindDeletedBefore(ctx, time.Now().Add(-time.Duration(s.gracePeriod)))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		// Dependent data goes first, if anything fails the user is still
+		// there and the purge is retried next time
+		if err := s.rewardRepository.DeleteRedemptions(ctx, user.ID); err != nil {
+			return purged, err
+		}
+
+		if err := s.userRepository.PurgeUser(ctx, user.ID); err != nil {
+			// Already purged by another instance
+			if errors.Is(err, util.ErrUserNotFound) {
+				continue
+			}
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/tracing"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type RewardService interface {
+	GetRewards(ctx context.Context, onlyAvailable bool) ([]model.Reward, error)
+	GetReward(ctx context.Context, id string) (model.Reward, error)
+	CreateReward(ctx context.Context, rewardReq request.Reward) (model.Reward, error)
+	UpdateReward(ctx context.Context, id string, rewardReq request.Reward) error
+	DeleteReward(ctx context.Context, id string) error
+	Redeem(ctx context.Context, token string, rewardID string) (model.Redemption, error)
+	GetRedemptions(ctx context.Context, token string) ([]model.Redemption, error)
+	UpdateRedemptionStatus(ctx context.Context, id string, status model.RedemptionStatus) error
+}
+
+type RewardServiceImpl struct {
+	repository  repository.RewardRepository
+	userService UserService
+	users       repository.UserRepository
+	audit       AuditService
+	tx          repository.Transactor
+	outbox      repository.OutboxRepository
+}
+
+func RewardServiceInit(
+	repository repository.RewardRepository,
+	userService UserService,
+	users repository.UserRepository,
+	audit AuditService,
+	tx repository.Transactor,
+	outbox repository.OutboxRepository,
+) *RewardServiceImpl {
+	return &RewardServiceImpl{repository: repository, userService: userService, users: users, audit: audit, tx: tx, outbox: outbox}
+}
+
+// GetRewards returns the reward catalog, only the redeemable rewards if onlyAvailable is set
+func (s RewardServiceImpl) GetRewards(ctx context.Context, onlyAvailable bool) (_ []model.Reward, err error) {
+	ctx, span := tracing.Start(ctx, "RewardService.GetRewards")
+	defer tracing.End(span, &err)
+
+	return s.repository.GetRewards(ctx, onlyAvailable)
+}
+
+// GetReward returns a single reward of the catalog
+func (s RewardServiceImpl) GetReward(ctx context.Context, id string) (_ model.Reward, err error) {
+	ctx, span := tracing.Start(ctx, "RewardService.GetReward")
+	defer tracing.End(span, &err)
+
+	return s.repository.GetReward(ctx, id)
+}
+
+// CreateReward validates and adds a new reward to the catalog
+func (s RewardServiceImpl) CreateReward(ctx context.Context, rewardReq request.Reward) (_ model.Reward, err error) {
+	ctx, span := tracing.Start(ctx, "RewardService.CreateReward")
+	defer tracing.End(span, &err)
+
+	reward := rewardFromRequest(rewardReq)
+	if err := validateReward(reward); err != nil {
+		return model.Reward{}, err
+	}
+
+	reward.Since = time.Now()
+	return s.repository.CreateReward(ctx, reward)
+}
+
+// UpdateReward validates and replaces the fields of an existing reward
+func (s RewardServiceImpl) UpdateReward(ctx context.Context, id string, rewardReq request.Reward) (err error) {
+	ctx, span := tracing.Start(ctx, "RewardService.UpdateReward")
+	defer tracing.End(span, &err)
+
+	reward := rewardFromRequest(rewardReq)
+	if err := validateReward(reward); err != nil {
+		return err
+	}
+
+	reward.ID = id
+	return s.repository.UpdateReward(ctx, reward)
+}
+
+// DeleteReward removes a reward from the catalog
+func (s RewardServiceImpl) DeleteReward(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "RewardService.DeleteReward")
+	defer tracing.End(span, &err)
+
+	return s.repository.DeleteReward(ctx, id)
+}
+
+// Redeem spends the points of the user who owns the token on a reward. Taking
+// the stock, charging the points and recording the redemption happen in one
+// transaction, so the reward is never oversold and the user is never charged
+// for a reward out of stock. The balance is also checked before writing, so
+// storages without transactions don't lose stock to users who can't pay. The
+// points change is audited once the transaction ends
+func (s RewardServiceImpl) Redeem(ctx context.Context, token string, rewardID string) (_ model.Redemption, err error) {
+	ctx, span := tracing.Start(ctx, "RewardService.Redeem")
+	defer tracing.End(span, &err)
+
+	user, err := s.userService.GetUserByToken(ctx, token)
+	if err != nil {
+		return model.Redemption{}, err
+	}
+
+	reward, err := s.repository.GetReward(ctx, rewardID)
+	if err != nil {
+		return model.Redemption{}, err
+	}
+	if user.Points < reward.Cost {
+		return model.Redemption{}, util.ErrNotEnoughPoints
+	}
+
+	var redemption model.Redemption
+	charged := false
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		reward, err := s.repository.TakeStock(ctx, rewardID)
+		if err != nil {
+			return err
+		}
+		charged = true
+		if err := s.addPoints(ctx, user, -reward.Cost); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		redemption, err = s.repository.CreateRedemption(ctx, model.Redemption{
+			UserID:     user.ID,
+			RewardID:   reward.ID,
+			RewardName: reward.Name,
+			Cost:       reward.Cost,
+			Status:     model.RedemptionPending,
+			Since:      now,
+			UpdatedAt:  now,
+		})
+		return err
+	})
+	if charged {
+		s.audit.Record(ctx, pointsChangedEvent(user, user.Points-reward.Cost, err))
+	}
+	if err != nil {
+		return model.Redemption{}, err
+	}
+	return redemption, nil
+}
+
+// GetRedemptions returns the redemption history of the user who owns the token
+func (s RewardServiceImpl) GetRedemptions(ctx context.Context, token string) (_ []model.Redemption, err error) {
+	ctx, span := tracing.Start(ctx, "RewardService.GetRedemptions")
+	defer tracing.End(span, &err)
+
+	user, err := s.userService.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetRedemptions(ctx, user.ID)
+}
+
+// UpdateRedemptionStatus moves a pending redemption to fulfilled or cancelled.
+// Cancelling refunds the points to the user and puts the reward back in stock
+func (s RewardServiceImpl) UpdateRedemptionStatus(ctx context.Context, id string, status model.RedemptionStatus) (err error) {
+	ctx, span := tracing.Start(ctx, "RewardService.UpdateRedemptionStatus")
+	defer tracing.End(span, &err)
+
+	redemption, err := s.repository.GetRedemption(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !redemption.Status.CanTransitionTo(status) {
+		return util.ErrInvalidStatusTransition
+	}
+
+	if status != model.RedemptionCancelled {
+		return s.repository.UpdateRedemptionStatus(ctx, id, redemption.Status, status)
+	}
+
+	user, err := s.users.FindByID(ctx, redemption.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Cancelled is final, it's only set if the refund is written with it
+	refunded := false
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repository.UpdateRedemptionStatus(ctx, id, redemption.Status, status); err != nil {
+			return err
+		}
+		refunded = true
+		if err := s.addPoints(ctx, user, redemption.Cost); err != nil {
+			return err
+		}
+
+		// The reward may have been removed from the catalog since, nothing to give back then
+		if err := s.repository.ReturnStock(ctx, redemption.RewardID); err != nil && !errors.Is(err, util.ErrRewardNotFound) {
+			return err
+		}
+		return nil
+	})
+	if refunded {
+		s.audit.Record(ctx, pointsChangedEvent(user, user.Points+redemption.Cost, err))
+	}
+	return err
+}
+
+// addPoints adds points to the user within the running transaction and adds
+// the points changed event to the outbox with them, so it's only dispatched
+// if the transaction commits
+func (s RewardServiceImpl) addPoints(ctx context.Context, user model.User, points int32) error {
+	if err := s.users.AddPoints(ctx, user.ID, points); err != nil {
+		return err
+	}
+	return s.outbox.AddEvents(ctx, model.NewPointsChanged(user, user.Points, user.Points+points))
+}
+
+// rewardFromRequest maps the editable fields of a reward request to a reward
+func rewardFromRequest(rewardReq request.Reward) model.Reward {
+	return model.Reward{
+		Name:           rewardReq.Name,
+		Description:    rewardReq.Description,
+		Cost:           rewardReq.Cost,
+		Stock:          rewardReq.Stock,
+		AvailableFrom:  rewardReq.AvailableFrom,
+		AvailableUntil: rewardReq.AvailableUntil,
+	}
+}
+
+// validateReward checks that the reward can be part of the catalog
+func validateReward(reward model.Reward) error {
+	if reward.Name == "" || reward.Cost <= 0 || reward.Stock < 0 {
+		return util.ErrInvalidReward
+	}
+	if !reward.AvailableFrom.IsZero() && !reward.AvailableUntil.IsZero() && !reward.AvailableFrom.Before(reward.AvailableUntil) {
+		return util.ErrInvalidReward
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+// rewardTest is a reward service on in memory repositories, with a user
+// holding 100 points and a reward costing 100
+type rewardTest struct {
+	service *RewardServiceImpl
+	users   *repository.MemoryUserRepositoryImpl
+	rewards *repository.MemoryRewardRepositoryImpl
+	audit   *txAuditRepository
+	tx      *fakeTransactor
+	user    model.User
+	reward  model.Reward
+}
+
+func newRewardTest(t *testing.T) rewardTest {
+	t.Helper()
+	ctx := context.Background()
+	users := repository.MemoryUserRepositoryInit()
+	rewards := repository.MemoryRewardRepositoryInit()
+	audit := newTxAuditRepository()
+	tx := &fakeTransactor{audit: audit}
+
+	user, err := users.CreateUser(ctx, model.User{Username: "alice", Role: "user", Token: "alice-token", Points: 100, Since: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateUser error = %v", err)
+	}
+	reward, err := rewards.CreateReward(ctx, model.Reward{Name: "Mug", Cost: 100, Stock: 5, Since: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateReward error = %v", err)
+	}
+
+	auditService := AuditServiceInit(audit, false)
+	outbox := repository.MemoryOutboxRepositoryInit()
+	userService := UserServiceInit(users, DeleteGracePeriod(time.Hour), auditService, tx, outbox)
+	return rewardTest{
+		service: RewardServiceInit(rewards, userService, users, auditService, tx, outbox),
+		users:   users,
+		rewards: rewards,
+		audit:   audit,
+		tx:      tx,
+		user:    user,
+		reward:  reward,
+	}
+}
+
+// pointsEvents returns the audited points changes
+func (rt rewardTest) pointsEvents(t *testing.T) []model.AuditEvent {
+	t.Helper()
+	events, _, err := rt.audit.GetEvents(context.Background(), repository.AuditQuery{Action: model.AuditPointsChanged})
+	if err != nil {
+		t.Fatalf("GetEvents error = %v", err)
+	}
+	return events
+}
+
+func TestRedeemAuditsThePointsChange(t *testing.T) {
+	rt := newRewardTest(t)
+
+	redemption, err := rt.service.Redeem(context.Background(), rt.user.Token, rt.reward.ID)
+	if err != nil {
+		t.Fatalf("Redeem error = %v", err)
+	}
+	if redemption.Cost != rt.reward.Cost || redemption.Status != model.RedemptionPending {
+		t.Errorf("redemption = %+v, want pending costing %d", redemption, rt.reward.Cost)
+	}
+
+	events := rt.pointsEvents(t)
+	if len(events) != 1 || events[0].Outcome != model.AuditSuccess {
+		t.Fatalf("points events = %+v, want one success", events)
+	}
+	if change := events[0].Changes[0]; change.Before != "100" || change.After != "0" {
+		t.Errorf("points change = %+v, want 100 to 0", change)
+	}
+}
+
+func TestFailedRedeemKeepsItsAuditEvent(t *testing.T) {
+	rt := newRewardTest(t)
+	ctx := context.Background()
+
+	// The points are spent elsewhere after the balance check of Redeem, so
+	// charging them fails inside the transaction and it rolls back
+	rt.tx.before = func() {
+		if err := rt.users.AddPoints(ctx, rt.user.ID, -50); err != nil {
+			t.Fatalf("AddPoints error = %v", err)
+		}
+	}
+
+	_, err := rt.service.Redeem(ctx, rt.user.Token, rt.reward.ID)
+	if !errors.Is(err, util.ErrNotEnoughPoints) {
+		t.Fatalf("Redeem error = %v, want %v", err, util.ErrNotEnoughPoints)
+	}
+
+	events := rt.pointsEvents(t)
+	if len(events) != 1 {
+		t.Fatalf("points events = %+v, want the failed change kept after the rollback", events)
+	}
+	if events[0].Outcome != model.AuditFailure || events[0].Reason != util.ErrNotEnoughPoints.Error() {
+		t.Errorf("event outcome = %s, reason = %q, want failure %q", events[0].Outcome, events[0].Reason, util.ErrNotEnoughPoints.Error())
+	}
+}
+
+func TestCancelRefundsAndAudits(t *testing.T) {
+	rt := newRewardTest(t)
+	ctx := context.Background()
+
+	redemption, err := rt.service.Redeem(ctx, rt.user.Token, rt.reward.ID)
+	if err != nil {
+		t.Fatalf("Redeem error = %v", err)
+	}
+	if err := rt.service.UpdateRedemptionStatus(ctx, redemption.ID, model.RedemptionCancelled); err != nil {
+		t.Fatalf("UpdateRedemptionStatus error = %v", err)
+	}
+
+	user, err := rt.users.FindByID(ctx, rt.user.ID)
+	if err != nil || user.Points != 100 {
+		t.Errorf("user points = %d, %v, want the 100 refunded", user.Points, err)
+	}
+	reward, err := rt.rewards.GetReward(ctx, rt.reward.ID)
+	if err != nil || reward.Stock != rt.reward.Stock {
+		t.Errorf("reward stock = %d, %v, want %d back", reward.Stock, err, rt.reward.Stock)
+	}
+
+	events := rt.pointsEvents(t)
+	if len(events) != 2 {
+		t.Fatalf("points events = %+v, want the charge and the refund", events)
+	}
+	for _, event := range events {
+		if event.Outcome != model.AuditSuccess {
+			t.Errorf("event = %+v, want success", event)
+		}
+	}
+}
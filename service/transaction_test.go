@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+)
+
+// fakeSession stands for the session mongo stores in the ctx of a transaction
+type fakeSession struct {
+	mongo.Session
+}
+
+// fakeTransactor runs fn like the mongo transactor: ctx carries a session and
+// nested calls join the running transaction. The audit events written with
+// the session are dropped if the transaction rolls back. before runs ahead of
+// every transaction, to change the data after the checks of the caller
+type fakeTransactor struct {
+	audit  *txAuditRepository
+	before func()
+}
+
+func (t fakeTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	if t.before != nil {
+		t.before()
+	}
+	err := fn(mongo.NewSessionContext(ctx, fakeSession{}))
+	t.audit.end(err == nil)
+	return err
+}
+
+// txAuditRepository is an in memory audit repository that only keeps the
+// events written inside a transaction once it commits
+type txAuditRepository struct {
+	*repository.MemoryAuditRepositoryImpl
+
+	mu      sync.Mutex
+	pending []model.AuditEvent
+}
+
+func newTxAuditRepository() *txAuditRepository {
+	return &txAuditRepository{MemoryAuditRepositoryImpl: repository.MemoryAuditRepositoryInit()}
+}
+
+func (r *txAuditRepository) CreateEvent(ctx context.Context, event model.AuditEvent) error {
+	if mongo.SessionFromContext(ctx) == nil {
+		return r.MemoryAuditRepositoryImpl.CreateEvent(ctx, event)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, event)
+	return nil
+}
+
+// end writes the events of the transaction if it commits and drops them if not
+func (r *txAuditRepository) end(commit bool) {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	if !commit {
+		return
+	}
+	for _, event := range pending {
+		r.MemoryAuditRepositoryImpl.CreateEvent(context.Background(), event)
+	}
+}
@@ -3,47 +3,75 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"ignaciofp.es/web-service-portfolio/model"
 	"ignaciofp.es/web-service-portfolio/model/request"
 	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/tracing"
 	"ignaciofp.es/web-service-portfolio/util"
 )
 
 type UserService interface {
 	GetUserByToken(ctx context.Context, token string) (model.User, error)
 	GetUserWithPass(ctx context.Context, token string) (model.User, error)
-	GetUserByFilter(ctx context.Context, filter bson.D) (model.User, error)
-	CreateUser(ctx context.Context, user model.User) error
+	GetUserByQuery(ctx context.Context, query repository.UserQuery) (model.User, error)
+	CreateUser(ctx context.Context, user model.User) (model.User, error)
 	UpdateUser(ctx context.Context, token string, updateReq request.Update) error
 	DeleteUser(ctx context.Context, token string) error
+	AddPoints(ctx context.Context, id string, points int32) error
+	RestoreUser(ctx context.Context, user model.User, token string) error
 }
 
+// DeleteGracePeriod is how long a deleted account can be restored before it's purged
+type DeleteGracePeriod time.Duration
+
 type UserServiceImpl struct {
-	repository repository.UserRepository
+	repository  repository.UserRepository
+	gracePeriod DeleteGracePeriod
+	audit       AuditService
+	tx          repository.Transactor
+	outbox      repository.OutboxRepository
 }
 
-func UserServiceInit(repository repository.UserRepository) *UserServiceImpl {
-	return &UserServiceImpl{repository: repository}
+func UserServiceInit(
+	repository repository.UserRepository,
+	gracePeriod DeleteGracePeriod,
+	audit AuditService,
+	tx repository.Transactor,
+	outbox repository.OutboxRepository,
+) *UserServiceImpl {
+	return &UserServiceImpl{repository: repository, gracePeriod: gracePeriod, audit: audit, tx: tx, outbox: outbox}
 }
 
-// GetUser finds a user in the database using the specified filter and returns it
-func (s UserServiceImpl) GetUserByToken(ctx context.Context, token string) (model.User, error) {
-	user, err := s.repository.GetUser(ctx, bson.D{{Key: "token", Value: token}})
+// GetUserByToken finds the user who owns the token and returns it without its password
+func (s UserServiceImpl) GetUserByToken(ctx context.Context, token string) (_ model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByToken")
+	defer tracing.End(span, &err)
+
+	user, err := s.repository.FindByToken(ctx, token)
 	user.Password = "" // Easy way to remove password
 	return user, err
 }
 
-func (s UserServiceImpl) GetUserWithPass(ctx context.Context, token string) (model.User, error) {
-	return s.repository.GetUser(ctx, bson.D{{Key: "token", Value: token}})
+// GetUserWithPass finds the user who owns the token and returns it including its password
+func (s UserServiceImpl) GetUserWithPass(ctx context.Context, token string) (_ model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserWithPass")
+	defer tracing.End(span, &err)
+
+	return s.repository.FindByToken(ctx, token)
 }
 
-func (s UserServiceImpl) GetUserByFilter(ctx context.Context, filter bson.D) (model.User, error) {
-	user, err := s.repository.GetUser(ctx, filter)
+// GetUserByQuery finds the user that matches the query. A missing user is reported
+// as wrong credentials so callers authenticating don't leak which usernames exist
+func (s UserServiceImpl) GetUserByQuery(ctx context.Context, query repository.UserQuery) (_ model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByQuery")
+	defer tracing.End(span, &err)
+
+	user, err := s.repository.FindOne(ctx, query)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
+		if errors.Is(err, util.ErrUserNotFound) {
 			return model.User{}, util.ErrInvalidUsernameOrPassword
 		}
 		return model.User{}, err
@@ -52,7 +80,10 @@ func (s UserServiceImpl) GetUserByFilter(ctx context.Context, filter bson.D) (mo
 }
 
 // UpdateUser updates a user in the database and returns it
-func (s UserServiceImpl) UpdateUser(ctx context.Context, token string, updateReq request.Update) error {
+func (s UserServiceImpl) UpdateUser(ctx context.Context, token string, updateReq request.Update) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer tracing.End(span, &err)
+
 	// Making sure user exists and token is valid before updating anything
 	user, err := s.GetUserByToken(ctx, token)
 	if err != nil {
@@ -66,17 +97,104 @@ func (s UserServiceImpl) UpdateUser(ctx context.Context, token string, updateReq
 	return s.repository.UpdateUser(ctx, token, updateReq)
 }
 
-// CreateUser creates a user in the database
-func (s UserServiceImpl) CreateUser(ctx context.Context, user model.User) error {
+// CreateUser creates a user in the database and returns it with its id
+func (s UserServiceImpl) CreateUser(ctx context.Context, user model.User) (_ model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer tracing.End(span, &err)
+
 	// Username and password are required
 	if user.Password == "" || user.Username == "" {
-		return util.ErrNoUsernameOrPasswordProvided
+		return model.User{}, util.ErrNoUsernameOrPasswordProvided
 	}
 
 	return s.repository.CreateUser(ctx, user)
 }
 
-// DeleteUser deletes a user in the database
-func (s UserServiceImpl) DeleteUser(ctx context.Context, token string) error {
-	return s.repository.DeleteUser(ctx, token)
+// DeleteUser soft deletes a user in the database. It can be restored during the grace period
+func (s UserServiceImpl) DeleteUser(ctx context.Context, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer tracing.End(span, &err)
+
+	user, err := s.GetUserByToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repository.DeleteUser(ctx, token); err != nil {
+			return err
+		}
+		return s.outbox.AddEvents(ctx, model.NewUserDeleted(user))
+	})
+	outcome, reason := auditOutcome(err)
+	s.audit.Record(ctx, model.AuditEvent{
+		Action:   model.AuditDelete,
+		TargetID: user.ID,
+		Username: user.Username,
+		Outcome:  outcome,
+		Reason:   reason,
+	})
+	return err
+}
+
+// AddPoints adds (or subtracts if negative) points to the user with the given id
+func (s UserServiceImpl) AddPoints(ctx context.Context, id string, points int32) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.AddPoints")
+	defer tracing.End(span, &err)
+
+	user, err := s.repository.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repository.AddPoints(ctx, id, points); err != nil {
+			return err
+		}
+		return s.outbox.AddEvents(ctx, model.NewPointsChanged(user, user.Points, user.Points+points))
+	})
+	s.audit.Record(ctx, pointsChangedEvent(user, user.Points+points, err))
+	return err
+}
+
+// RestoreUser restores a deleted user giving it a new token, only if it was
+// deleted less than the grace period ago
+func (s UserServiceImpl) RestoreUser(ctx context.Context, user model.User, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RestoreUser")
+	defer tracing.End(span, &err)
+
+	if user.DeletedAt == nil {
+		return util.ErrUserNotFound
+	}
+
+	err = util.ErrRestorePeriodExpired
+	if time.Since(*user.DeletedAt) <= time.Duration(s.gracePeriod) {
+		err = s.repository.RestoreUser(ctx, user.ID, token)
+	}
+
+	outcome, reason := auditOutcome(err)
+	s.audit.Record(ctx, model.AuditEvent{
+		Action:   model.AuditRestore,
+		TargetID: user.ID,
+		Username: user.Username,
+		Outcome:  outcome,
+		Reason:   reason,
+	})
+	return err
+}
+
+// pointsChangedEvent is the audit event of the change of the points of the
+// user to the given amount
+func pointsChangedEvent(user model.User, points int32, err error) model.AuditEvent {
+	outcome, reason := auditOutcome(err)
+	return model.AuditEvent{
+		Action:   model.AuditPointsChanged,
+		TargetID: user.ID,
+		Username: user.Username,
+		Changes: []model.AuditChange{
+			{Field: "points", Before: fmt.Sprint(user.Points), After: fmt.Sprint(points)},
+		},
+		Outcome: outcome,
+		Reason:  reason,
+	}
 }
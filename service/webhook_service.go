@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/model/request"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/tracing"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+type WebhookService interface {
+	GetSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (model.WebhookSubscription, error)
+	CreateSubscription(ctx context.Context, subscriptionReq request.WebhookSubscription) (model.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, id string, subscriptionReq request.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+	GetDeliveries(ctx context.Context, query repository.WebhookDeliveryQuery) ([]model.WebhookDelivery, int64, error)
+	ReplayDelivery(ctx context.Context, subscriptionID string, deliveryID string) error
+}
+
+type WebhookServiceImpl struct {
+	repository repository.WebhookRepository
+}
+
+func WebhookServiceInit(repository repository.WebhookRepository) *WebhookServiceImpl {
+	return &WebhookServiceImpl{repository: repository}
+}
+
+// GetSubscriptions returns every webhook subscription without its secret
+func (s WebhookServiceImpl) GetSubscriptions(ctx context.Context) (_ []model.WebhookSubscription, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetSubscriptions")
+	defer tracing.End(span, &err)
+
+	subscriptions, err := s.repository.GetSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription returns a single subscription without its secret
+func (s WebhookServiceImpl) GetSubscription(ctx context.Context, id string) (_ model.WebhookSubscription, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetSubscription")
+	defer tracing.End(span, &err)
+
+	subscription, err := s.repository.GetSubscription(ctx, id)
+	subscription.Secret = ""
+	return subscription, err
+}
+
+// CreateSubscription validates and stores a new subscription. A secret is
+// generated if none is given. The secret is only returned here
+func (s WebhookServiceImpl) CreateSubscription(ctx context.Context, subscriptionReq request.WebhookSubscription) (_ model.WebhookSubscription, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.CreateSubscription")
+	defer tracing.End(span, &err)
+
+	subscription := model.WebhookSubscription{
+		URL:    subscriptionReq.URL,
+		Secret: subscriptionReq.Secret,
+		Active: true,
+		Since:  time.Now(),
+	}
+	if subscriptionReq.Active != nil {
+		subscription.Active = *subscriptionReq.Active
+	}
+	for _, eventType := range subscriptionReq.EventTypes {
+		subscription.EventTypes = append(subscription.EventTypes, model.DomainEventType(eventType))
+	}
+	if err := validateWebhook(subscription); err != nil {
+		return model.WebhookSubscription{}, err
+	}
+
+	if subscription.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return model.WebhookSubscription{}, err
+		}
+		subscription.Secret = secret
+	}
+	return s.repository.CreateSubscription(ctx, subscription)
+}
+
+// UpdateSubscription validates and replaces the url and event types of the
+// subscription. The secret is rotated if a new one is given and the
+// subscription is paused or resumed if active is set
+func (s WebhookServiceImpl) UpdateSubscription(ctx context.Context, id string, subscriptionReq request.WebhookSubscription) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.UpdateSubscription")
+	defer tracing.End(span, &err)
+
+	subscription, err := s.repository.GetSubscription(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	subscription.URL = subscriptionReq.URL
+	subscription.EventTypes = nil
+	for _, eventType := range subscriptionReq.EventTypes {
+		subscription.EventTypes = append(subscription.EventTypes, model.DomainEventType(eventType))
+	}
+	if subscriptionReq.Secret != "" {
+		subscription.Secret = subscriptionReq.Secret
+	}
+	if subscriptionReq.Active != nil {
+		subscription.Active = *subscriptionReq.Active
+	}
+	if err := validateWebhook(subscription); err != nil {
+		return err
+	}
+	return s.repository.UpdateSubscription(ctx, subscription)
+}
+
+// DeleteSubscription removes the subscription, its pending deliveries are dropped
+func (s WebhookServiceImpl) DeleteSubscription(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeleteSubscription")
+	defer tracing.End(span, &err)
+
+	return s.repository.DeleteSubscription(ctx, id)
+}
+
+// GetDeliveries returns a page of the delivery log of a subscription
+func (s WebhookServiceImpl) GetDeliveries(ctx context.Context, query repository.WebhookDeliveryQuery) (_ []model.WebhookDelivery, _ int64, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetDeliveries")
+	defer tracing.End(span, &err)
+
+	if _, err := s.repository.GetSubscription(ctx, query.SubscriptionID); err != nil {
+		return nil, 0, err
+	}
+	return s.repository.GetDeliveries(ctx, query)
+}
+
+// ReplayDelivery sends a delivery of the subscription again, even if it was
+// already delivered or is dead
+func (s WebhookServiceImpl) ReplayDelivery(ctx context.Context, subscriptionID string, deliveryID string) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.ReplayDelivery")
+	defer tracing.End(span, &err)
+
+	delivery, err := s.repository.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery.SubscriptionID != subscriptionID {
+		return util.ErrWebhookDeliveryNotFound
+	}
+	return s.repository.ReplayDelivery(ctx, deliveryID)
+}
+
+// validateWebhook checks that the subscription has an absolute http or https
+// url and at least one event type, all of them known
+func validateWebhook(subscription model.WebhookSubscription) error {
+	target, err := url.Parse(subscription.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return util.ErrInvalidWebhook
+	}
+	if len(subscription.EventTypes) == 0 {
+		return util.ErrInvalidWebhook
+	}
+	for _, eventType := range subscription.EventTypes {
+		if !eventType.IsValid() {
+			return util.ErrInvalidWebhook
+		}
+	}
+	return nil
+}
+
+// generateWebhookSecret generates a random secret to sign the payloads
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,141 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/service"
+	"ignaciofp.es/web-service-portfolio/tracing"
+)
+
+// The tracer of the app keeps the first global provider, so the tests share
+// one and reset its exporter
+var (
+	exporter = tracetest.NewInMemoryExporter()
+	provider *sdktrace.TracerProvider
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	if provider, err = tracing.ProviderInit(exporter); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	provider.Shutdown(context.Background())
+	os.Exit(code)
+}
+
+// newTracedRouter returns a router tracing GET /rewards/:id, served by the
+// reward service, and a reward it can get
+func newTracedRouter(t *testing.T) (*gin.Engine, model.Reward) {
+	t.Helper()
+	exporter.Reset()
+
+	rewards := repository.MemoryRewardRepositoryInit()
+	reward, err := rewards.CreateReward(context.Background(), model.Reward{Name: "Mug", Cost: 100, Stock: 1})
+	if err != nil {
+		t.Fatalf("CreateReward error = %v", err)
+	}
+	rewardService := service.RewardServiceInit(rewards, nil, nil, nil, repository.NoTransactor{}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(tracing.Middleware())
+	router.GET("/rewards/:id", func(ctx *gin.Context) {
+		reward, err := rewardService.GetReward(ctx.Request.Context(), ctx.Param("id"))
+		if err != nil {
+			ctx.Error(err)
+			ctx.Status(http.StatusNotFound)
+			return
+		}
+		ctx.JSON(http.StatusOK, reward)
+	})
+	return router, reward
+}
+
+// spans flushes the provider and returns the recorded spans by name
+func spans(t *testing.T) map[string]tracetest.SpanStub {
+	t.Helper()
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush error = %v", err)
+	}
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		byName[span.Name] = span
+	}
+	return byName
+}
+
+func TestMiddlewareTracesServiceMethods(t *testing.T) {
+	router, reward := newTracedRouter(t)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/rewards/"+reward.ID, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	recorded := spans(t)
+	if len(recorded) != 2 {
+		t.Fatalf("recorded %d spans, want 2: %v", len(recorded), recorded)
+	}
+	server, ok := recorded["GET /rewards/:id"]
+	if !ok {
+		t.Fatalf("no span named after the route template, got %v", recorded)
+	}
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("request span kind = %s, want %s", server.SpanKind, trace.SpanKindServer)
+	}
+	method, ok := recorded["RewardService.GetReward"]
+	if !ok {
+		t.Fatalf("no span of the service method, got %v", recorded)
+	}
+	if method.Parent.SpanID() != server.SpanContext.SpanID() || method.SpanContext.TraceID() != server.SpanContext.TraceID() {
+		t.Errorf("service span parent = %s, want the request span %s", method.Parent.SpanID(), server.SpanContext.SpanID())
+	}
+	if method.Status.Code == codes.Error {
+		t.Errorf("service span status = %v, want it not failed", method.Status)
+	}
+}
+
+func TestMiddlewareRecordsFailures(t *testing.T) {
+	router, _ := newTracedRouter(t)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/rewards/missing", nil))
+
+	recorded := spans(t)
+	method := recorded["RewardService.GetReward"]
+	if method.Status.Code != codes.Error || len(method.Events) == 0 {
+		t.Errorf("service span status = %v with %d events, want failed with the error recorded", method.Status, len(method.Events))
+	}
+	if server := recorded["GET /rewards/:id"]; len(server.Events) == 0 {
+		t.Errorf("request span has no events, want the error of the handler recorded")
+	}
+}
+
+func TestMiddlewareContinuesCallerTrace(t *testing.T) {
+	router, reward := newTracedRouter(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/rewards/"+reward.ID, nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	server := spans(t)["GET /rewards/:id"]
+	if got := server.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("trace id = %s, want the caller's %s", got, traceID)
+	}
+	if got := server.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span id = %s, want the caller's 00f067aa0ba902b7", got)
+	}
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+)
+
+// AppError is an error clients are told about: a stable code they can match
+// on, the HTTP status it's answered with, a message and optional details.
+// Errors that are not an AppError are internal and reach clients as a generic
+// internal error
+type AppError struct {
+	Code    string
+	Status  int
+	Message string
+	Details map[string]any
+}
+
+// NewAppError returns an error with the given code, HTTP status and message
+func NewAppError(code string, status int, message string) *AppError {
+	return &AppError{Code: code, Status: status, Message: message}
+}
+
+func (e *AppError) Error() string {
+	return e.Message
+}
+
+// Is matches errors with the same code, so copies with details still match
+// the error they were made from
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
+}
+
+// WithDetail returns a copy of the error with the detail added
+func (e *AppError) WithDetail(key string, value any) *AppError {
+	details := make(map[string]any, len(e.Details)+1)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details[key] = value
+
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// WithMessage returns a copy of the error with another message
+func (e *AppError) WithMessage(message string) *AppError {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+// AsAppError returns the AppError in the chain of err or ErrInternal if there
+// is none
+func AsAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return ErrInternal
+}
+
+// ErrInternal is answered for every error clients must not see the details of
+var ErrInternal = NewAppError("internal_error", http.StatusInternalServerError, "internal server error")
@@ -0,0 +1,46 @@
+package util
+
+import "context"
+
+type contextKey string
+
+const requestInfoKey contextKey = "request_info"
+
+// RequestInfo describes who is making the request the context belongs to
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+	// ActorID is the authenticated user making the request, if known
+	ActorID string
+}
+
+// WithRequestInfo returns a copy of ctx carrying the request info
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey, info)
+}
+
+// GetRequestInfo returns the request info of ctx or an empty one if it has none
+func GetRequestInfo(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey).(RequestInfo)
+	return info
+}
+
+// ClientIP returns the address of the client making the request of ctx, or ""
+// outside requests. It's already resolved through the trusted proxies, it's
+// the one every feature reading the client address must use
+func ClientIP(ctx context.Context) string {
+	return GetRequestInfo(ctx).IP
+}
+
+const requestIDKey contextKey = "request_id"
+
+// WithRequestID returns a copy of ctx carrying the id of its request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// GetRequestID returns the id of the request of ctx or "" if it has none
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
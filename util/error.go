@@ -2,12 +2,56 @@ package util
 
 import (
 	"errors"
+	"net/http"
 )
 
+// Errors clients are told about, with their code and HTTP status
 var (
-	ErrNoUsernameOrPasswordProvided = errors.New("no username or password provided")
-	ErrInvalidUsernameOrPassword    = errors.New("username or password are wrong")
-	ErrNoValidTokenProvided         = errors.New("no valid token provided")
-	ErrUserNotFound                 = errors.New("user not found")
-	ErrUserAlreadyExists            = errors.New("user already exist")
+	ErrInvalidRequestBody           = NewAppError("invalid_request_body", http.StatusBadRequest, "invalid request body")
+	ErrValidation                   = NewAppError("validation_failed", http.StatusUnprocessableEntity, "some fields are invalid")
+	ErrRequestBodyTooLarge          = NewAppError("request_body_too_large", http.StatusRequestEntityTooLarge, "request body too large")
+	ErrUnsupportedMediaType         = NewAppError("unsupported_media_type", http.StatusUnsupportedMediaType, "request body must be JSON")
+	ErrInvalidQueryParam            = NewAppError("invalid_query_param", http.StatusBadRequest, "invalid query param")
+	ErrRouteNotFound                = NewAppError("route_not_found", http.StatusNotFound, "route not found")
+	ErrMethodNotAllowed             = NewAppError("method_not_allowed", http.StatusMethodNotAllowed, "method not allowed")
+	ErrMissingToken                 = NewAppError("missing_token", http.StatusUnauthorized, "missing token")
+	ErrNoUsernameOrPasswordProvided = NewAppError("missing_credentials", http.StatusBadRequest, "no username or password provided")
+	ErrInvalidUsernameOrPassword    = NewAppError("invalid_credentials", http.StatusBadRequest, "username or password are wrong")
+	ErrNoValidTokenProvided         = NewAppError("invalid_token", http.StatusUnauthorized, "no valid token provided")
+	ErrUserNotFound                 = NewAppError("user_not_found", http.StatusNotFound, "user not found")
+	ErrUserAlreadyExists            = NewAppError("user_already_exists", http.StatusConflict, "user already exist")
+	ErrRestorePeriodExpired         = NewAppError("restore_period_expired", http.StatusGone, "the account can't be restored anymore")
+	ErrForbidden                    = NewAppError("forbidden", http.StatusForbidden, "not allowed to perform this action")
+	ErrClientCertRequired           = NewAppError("client_certificate_required", http.StatusForbidden, "a valid client certificate is required")
+	ErrOriginNotAllowed             = NewAppError("origin_not_allowed", http.StatusForbidden, "cross-origin requests from this origin are not allowed")
+	ErrNotEnoughPoints              = NewAppError("not_enough_points", http.StatusConflict, "not enough points")
+	ErrRewardNotFound               = NewAppError("reward_not_found", http.StatusNotFound, "reward not found")
+	ErrRewardUnavailable            = NewAppError("reward_unavailable", http.StatusConflict, "reward is out of stock or not available")
+	ErrInvalidReward                = NewAppError("invalid_reward", http.StatusBadRequest, "reward needs a name, a positive cost and a non negative stock")
+	ErrRedemptionNotFound           = NewAppError("redemption_not_found", http.StatusNotFound, "redemption not found")
+	ErrInvalidStatusTransition      = NewAppError("invalid_status_transition", http.StatusConflict, "invalid redemption status transition")
+	ErrWebhookNotFound              = NewAppError("webhook_not_found", http.StatusNotFound, "webhook subscription not found")
+	ErrInvalidWebhook               = NewAppError("invalid_webhook", http.StatusBadRequest, "webhook needs an absolute http or https url and known event types")
+	ErrWebhookDeliveryNotFound      = NewAppError("webhook_delivery_not_found", http.StatusNotFound, "webhook delivery not found")
 )
+
+// Internal errors, they never reach clients as they are
+var (
+	ErrEmptyQuery          = errors.New("query needs at least one criteria")
+	ErrAuditEventNotFound  = errors.New("audit event not found")
+	ErrAuditSequenceTaken  = errors.New("audit event sequence already taken")
+	ErrOutboxEmpty         = errors.New("no events due for delivery")
+	ErrDomainEventNotFound = errors.New("domain event not found")
+	ErrNoWebhookDue        = errors.New("no webhook deliveries due")
+	ErrNoCertificates      = errors.New("no PEM certificates found")
+	ErrUniqueIndexChanged  = errors.New("unique index changed, it must be replaced by hand")
+)
+
+// TokenError turns a user not found by its token into an invalid token error,
+// the client sent the token, not a user id
+func TokenError(err error) error {
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrNoValidTokenProvided
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/event"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+const (
+	// dispatchLease is how long an event is locked by the dispatcher delivering it
+	dispatchLease = time.Minute
+	// dispatchPollInterval is how often the outbox is checked when it's empty
+	dispatchPollInterval = time.Second
+	// maxDispatchAttempts is how many times an event is tried before giving up
+	maxDispatchAttempts = 20
+	// maxRetryBackoff caps the time between attempts
+	maxRetryBackoff = time.Hour
+)
+
+// Dispatcher delivers the events in the outbox to every sink, retrying with
+// exponential backoff until every sink has it
+type Dispatcher struct {
+	outbox repository.OutboxRepository
+	sinks  []event.Sink
+}
+
+func DispatcherInit(outbox repository.OutboxRepository, sinks []event.Sink) *Dispatcher {
+	return &Dispatcher{outbox: outbox, sinks: sinks}
+}
+
+// Run delivers the events due until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		err := d.DispatchNext(ctx)
+		if err == nil {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if !errors.Is(err, util.ErrOutboxEmpty) {
+			logging.FromContext(ctx).Error("Error dispatching events", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dispatchPollInterval):
+		}
+	}
+}
+
+// DispatchNext delivers the next event due to the sinks it hasn't reached yet.
+// Returns ErrOutboxEmpty if there is no event to deliver
+func (d *Dispatcher) DispatchNext(ctx context.Context) error {
+	domainEvent, err := d.outbox.ClaimNext(ctx, dispatchLease)
+	if err != nil {
+		return err
+	}
+
+	var failures []error
+	for _, sink := range d.sinks {
+		if domainEvent.IsDeliveredTo(sink.Name()) {
+			continue
+		}
+
+		if err := d.deliver(ctx, sink, domainEvent); err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		if err := d.outbox.MarkDelivered(ctx, domainEvent.ID, sink.Name()); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) == 0 {
+		return d.outbox.MarkDispatched(ctx, domainEvent.ID)
+	}
+
+	failed := domainEvent.Attempts >= maxDispatchAttempts
+	lastError := errors.Join(failures...).Error()
+	if failed {
+		logging.FromContext(ctx).Error("Giving up dispatching event", "event_id", domainEvent.ID, "attempts", domainEvent.Attempts, "error", lastError)
+	}
+	return d.outbox.MarkRetry(ctx, domainEvent.ID, time.Now().Add(retryBackoff(domainEvent.Attempts)), lastError, failed)
+}
+
+// deliver sends the event to the sink, turning a panicking sink into an error
+func (d *Dispatcher) deliver(ctx context.Context, sink event.Sink, domainEvent model.DomainEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sink panicked: %v", r)
+		}
+	}()
+	return sink.Deliver(ctx, domainEvent)
+}
+
+// retryBackoff returns how long to wait before the next attempt: 1s, 2s, 4s...
+// up to maxRetryBackoff
+func retryBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 20 {
+		return maxRetryBackoff
+	}
+	return min(time.Second<<(attempts-1), maxRetryBackoff)
+}
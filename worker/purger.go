@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/service"
+)
+
+// PurgeInterval is how often the purger looks for accounts to purge
+type PurgeInterval time.Duration
+
+// Purger permanently removes the deleted accounts once their grace period is over
+type Purger struct {
+	service  service.PurgeService
+	interval PurgeInterval
+}
+
+func PurgerInit(service service.PurgeService, interval PurgeInterval) *Purger {
+	return &Purger{service: service, interval: interval}
+}
+
+// Run purges the expired accounts every interval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(p.interval))
+	defer ticker.Stop()
+
+	for {
+		purged, err := p.service.PurgeDeletedUsers(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("Error purging deleted users", "error", err)
+		} else if purged > 0 {
+			logging.FromContext(ctx).Info("Purged deleted users", "purged", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
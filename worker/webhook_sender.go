@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"ignaciofp.es/web-service-portfolio/event"
+	"ignaciofp.es/web-service-portfolio/logging"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/tracing"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+const (
+	// webhookLease is how long a delivery is locked by the sender trying it
+	webhookLease = time.Minute
+	// webhookTimeout is how long a receiver has to answer
+	webhookTimeout = 10 * time.Second
+	// maxWebhookAttempts is how many times a delivery is tried before it's dead
+	maxWebhookAttempts = 10
+	// maxWebhookErrorBody is how much of an error response is kept in the log
+	maxWebhookErrorBody = 512
+)
+
+// WebhookSender posts the queued webhook deliveries to the subscriptions,
+// retrying with exponential backoff until they are acknowledged or dead
+type WebhookSender struct {
+	repository repository.WebhookRepository
+	client     *http.Client
+}
+
+func WebhookSenderInit(repository repository.WebhookRepository) *WebhookSender {
+	return &WebhookSender{repository: repository, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Run sends the deliveries due until ctx is done
+func (s *WebhookSender) Run(ctx context.Context) {
+	for {
+		err := s.SendNext(ctx)
+		if err == nil {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if !errors.Is(err, util.ErrNoWebhookDue) {
+			logging.FromContext(ctx).Error("Error sending webhooks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dispatchPollInterval):
+		}
+	}
+}
+
+// SendNext posts the next delivery due and records the attempt. Returns
+// ErrNoWebhookDue if there is no delivery to send
+func (s *WebhookSender) SendNext(ctx context.Context) error {
+	delivery, err := s.repository.ClaimNextDelivery(ctx, webhookLease)
+	if err != nil {
+		return err
+	}
+
+	// Deliveries of deleted or paused subscriptions are not retried, they
+	// can be replayed once the subscription is active again
+	unreachable := false
+	attempt := model.WebhookAttempt{Time: time.Now()}
+	subscription, err := s.repository.GetSubscription(ctx, delivery.SubscriptionID)
+	switch {
+	case err != nil:
+		attempt.Error = err.Error()
+		unreachable = errors.Is(err, util.ErrWebhookNotFound)
+	case !subscription.Active:
+		attempt.Error = "subscription is not active"
+		unreachable = true
+	default:
+		attempt.StatusCode, err = s.post(ctx, subscription, delivery)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	}
+	attempt.Duration = time.Since(attempt.Time)
+
+	if attempt.Succeeded() {
+		return s.repository.RecordAttempt(ctx, delivery.ID, attempt, model.WebhookDeliveryDelivered, delivery.NextAttemptAt)
+	}
+
+	// Only the tries since the last replay count towards the limit
+	tries := delivery.Tries + 1
+	status := model.WebhookDeliveryPending
+	if tries >= maxWebhookAttempts || unreachable {
+		status = model.WebhookDeliveryDead
+		logging.FromContext(ctx).Warn("Webhook delivery is dead", "delivery_id", delivery.ID, "attempts", tries, "error", attempt.Error)
+	}
+	return s.repository.RecordAttempt(ctx, delivery.ID, attempt, status, time.Now().Add(retryBackoff(tries)))
+}
+
+// post sends the signed payload to the subscription url and returns the status
+// code. Non 2xx answers are returned as errors with the start of their body.
+// The trace context goes along, so receivers can join the trace
+func (s *WebhookSender) post(ctx context.Context, subscription model.WebhookSubscription, delivery model.WebhookDelivery) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "webhook "+string(delivery.EventType),
+		attribute.String("webhook.delivery_id", delivery.ID),
+		attribute.String("webhook.subscription_id", subscription.ID),
+	)
+	defer tracing.End(span, &err)
+
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "web-service-portfolio-webhooks")
+	req.Header.Set(event.WebhookIDHeader, delivery.ID)
+	req.Header.Set(event.WebhookEventHeader, string(delivery.EventType))
+	req.Header.Set(event.WebhookTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(event.WebhookSignatureHeader, event.SignWebhook(subscription.Secret, now, payload))
+	tracing.InjectHeaders(ctx, req.Header)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxWebhookErrorBody))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("receiver answered %s: %s", res.Status, body)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,242 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ignaciofp.es/web-service-portfolio/event"
+	"ignaciofp.es/web-service-portfolio/model"
+	"ignaciofp.es/web-service-portfolio/repository"
+	"ignaciofp.es/web-service-portfolio/util"
+)
+
+const testWebhookSecret = "test-secret"
+
+// receiver is a webhook endpoint that answers with the queued status codes,
+// 200 once they run out, and keeps the requests it got
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, http.StatusText(status))
+}
+
+func (r *receiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+// newWebhookTest subscribes a receiver answering with statuses to user.registered
+// events and queues a delivery of one. Returns the repository, the receiver and
+// the id of the delivery
+func newWebhookTest(t *testing.T, statuses ...int) (repository.WebhookRepository, *receiver, string) {
+	t.Helper()
+	ctx := context.Background()
+	repo := repository.MemoryWebhookRepositoryInit()
+
+	recv := &receiver{statuses: statuses}
+	server := httptest.NewServer(recv)
+	t.Cleanup(server.Close)
+
+	subscription, err := repo.CreateSubscription(ctx, model.WebhookSubscription{
+		URL:        server.URL,
+		EventTypes: []model.DomainEventType{model.UserRegistered},
+		Secret:     testWebhookSecret,
+		Active:     true,
+		Since:      time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription error = %v", err)
+	}
+
+	registered := model.NewUserRegistered(model.User{ID: "user-1", Username: "alice"})
+	registered.ID = "event-1"
+	if err := event.WebhookSinkInit(repo).Deliver(ctx, registered); err != nil {
+		t.Fatalf("Deliver error = %v", err)
+	}
+
+	deliveries, _, err := repo.GetDeliveries(ctx, repository.WebhookDeliveryQuery{SubscriptionID: subscription.ID})
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("GetDeliveries = %v, %v, want one delivery", deliveries, err)
+	}
+	return repo, recv, deliveries[0].ID
+}
+
+func mustGetDelivery(t *testing.T, repo repository.WebhookRepository, id string) model.WebhookDelivery {
+	t.Helper()
+	delivery, err := repo.GetDelivery(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetDelivery error = %v", err)
+	}
+	return delivery
+}
+
+func TestWebhookSenderSignsPayload(t *testing.T) {
+	repo, recv, id := newWebhookTest(t)
+	sender := WebhookSenderInit(repo)
+
+	if err := sender.SendNext(context.Background()); err != nil {
+		t.Fatalf("SendNext error = %v", err)
+	}
+
+	requests := recv.received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	got := requests[0]
+	if err := event.VerifyWebhook(testWebhookSecret, got.header.Get(event.WebhookTimestampHeader), got.header.Get(event.WebhookSignatureHeader), got.body, time.Minute); err != nil {
+		t.Errorf("VerifyWebhook error = %v", err)
+	}
+	if err := event.VerifyWebhook("other-secret", got.header.Get(event.WebhookTimestampHeader), got.header.Get(event.WebhookSignatureHeader), got.body, time.Minute); !errors.Is(err, event.ErrInvalidWebhookSignature) {
+		t.Errorf("VerifyWebhook with another secret error = %v, want %v", err, event.ErrInvalidWebhookSignature)
+	}
+	if header := got.header.Get(event.WebhookIDHeader); header != id {
+		t.Errorf("%s = %q, want %q", event.WebhookIDHeader, header, id)
+	}
+	if header := got.header.Get(event.WebhookEventHeader); header != string(model.UserRegistered) {
+		t.Errorf("%s = %q, want %q", event.WebhookEventHeader, header, model.UserRegistered)
+	}
+
+	delivery := mustGetDelivery(t, repo, id)
+	if string(got.body) != delivery.Payload {
+		t.Errorf("body = %s, want the payload %s", got.body, delivery.Payload)
+	}
+	if delivery.Status != model.WebhookDeliveryDelivered || delivery.DeliveredAt == nil {
+		t.Errorf("delivery status = %s, delivered at %v, want delivered", delivery.Status, delivery.DeliveredAt)
+	}
+	if len(delivery.Attempts) != 1 || delivery.Attempts[0].StatusCode != http.StatusOK || delivery.Attempts[0].Error != "" {
+		t.Errorf("attempts = %+v, want one with status 200", delivery.Attempts)
+	}
+}
+
+func TestWebhookSenderRetriesWithBackoff(t *testing.T) {
+	repo, recv, id := newWebhookTest(t, http.StatusServiceUnavailable)
+	sender := WebhookSenderInit(repo)
+	ctx := context.Background()
+
+	before := time.Now()
+	if err := sender.SendNext(ctx); err != nil {
+		t.Fatalf("SendNext error = %v", err)
+	}
+
+	delivery := mustGetDelivery(t, repo, id)
+	if delivery.Status != model.WebhookDeliveryPending || delivery.Tries != 1 {
+		t.Errorf("delivery status = %s, tries = %d, want pending with 1 try", delivery.Status, delivery.Tries)
+	}
+	if wait := delivery.NextAttemptAt.Sub(before); wait < retryBackoff(1) {
+		t.Errorf("next attempt in %s, want at least %s", wait, retryBackoff(1))
+	}
+	attempt := delivery.Attempts[0]
+	if attempt.StatusCode != http.StatusServiceUnavailable || !strings.Contains(attempt.Error, "Service Unavailable") {
+		t.Errorf("attempt = %+v, want status 503 with the body in the error", attempt)
+	}
+
+	// Not due until the backoff passes
+	if err := sender.SendNext(ctx); !errors.Is(err, util.ErrNoWebhookDue) {
+		t.Errorf("SendNext during the backoff error = %v, want %v", err, util.ErrNoWebhookDue)
+	}
+	if requests := recv.received(); len(requests) != 1 {
+		t.Errorf("receiver got %d requests, want 1", len(requests))
+	}
+
+	// Waits double with every failed try
+	for tries := 1; tries < 10; tries++ {
+		if retryBackoff(tries+1) != 2*retryBackoff(tries) && retryBackoff(tries+1) != maxRetryBackoff {
+			t.Errorf("retryBackoff(%d) = %s, want twice retryBackoff(%d) = %s", tries+1, retryBackoff(tries+1), tries, retryBackoff(tries))
+		}
+	}
+}
+
+func TestWebhookSenderDeadAfterMaxAttempts(t *testing.T) {
+	repo, _, id := newWebhookTest(t, http.StatusInternalServerError)
+	sender := WebhookSenderInit(repo)
+	ctx := context.Background()
+
+	// Recording the earlier failures due right away, to skip their backoff
+	for tries := 1; tries < maxWebhookAttempts; tries++ {
+		if err := repo.RecordAttempt(ctx, id, model.WebhookAttempt{Time: time.Now(), Error: "earlier failure"}, model.WebhookDeliveryPending, time.Now()); err != nil {
+			t.Fatalf("RecordAttempt error = %v", err)
+		}
+	}
+
+	if err := sender.SendNext(ctx); err != nil {
+		t.Fatalf("SendNext error = %v", err)
+	}
+	delivery := mustGetDelivery(t, repo, id)
+	if delivery.Status != model.WebhookDeliveryDead || delivery.Tries != maxWebhookAttempts {
+		t.Errorf("delivery status = %s, tries = %d, want dead with %d tries", delivery.Status, delivery.Tries, maxWebhookAttempts)
+	}
+	if err := sender.SendNext(ctx); !errors.Is(err, util.ErrNoWebhookDue) {
+		t.Errorf("SendNext of a dead delivery error = %v, want %v", err, util.ErrNoWebhookDue)
+	}
+}
+
+func TestWebhookSenderReplay(t *testing.T) {
+	repo, recv, id := newWebhookTest(t, http.StatusInternalServerError)
+	sender := WebhookSenderInit(repo)
+	ctx := context.Background()
+
+	if err := sender.SendNext(ctx); err != nil {
+		t.Fatalf("SendNext error = %v", err)
+	}
+
+	// A replay is sent right away, without waiting for the backoff
+	if err := repo.ReplayDelivery(ctx, id); err != nil {
+		t.Fatalf("ReplayDelivery error = %v", err)
+	}
+	if err := sender.SendNext(ctx); err != nil {
+		t.Fatalf("SendNext after replay error = %v", err)
+	}
+
+	delivery := mustGetDelivery(t, repo, id)
+	if delivery.Status != model.WebhookDeliveryDelivered || delivery.Tries != 0 {
+		t.Errorf("delivery status = %s, tries = %d, want delivered with 0 tries", delivery.Status, delivery.Tries)
+	}
+	if len(delivery.Attempts) != 2 || delivery.Attempts[0].StatusCode != http.StatusInternalServerError || delivery.Attempts[1].StatusCode != http.StatusOK {
+		t.Errorf("attempts = %+v, want a 500 and a 200", delivery.Attempts)
+	}
+
+	// Delivered webhooks can be replayed too, with the same body
+	if err := repo.ReplayDelivery(ctx, id); err != nil {
+		t.Fatalf("ReplayDelivery error = %v", err)
+	}
+	if err := sender.SendNext(ctx); err != nil {
+		t.Fatalf("SendNext after second replay error = %v", err)
+	}
+	requests := recv.received()
+	if len(requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(requests))
+	}
+	if string(requests[2].body) != string(requests[0].body) {
+		t.Errorf("replayed body = %s, want %s", requests[2].body, requests[0].body)
+	}
+	if len(mustGetDelivery(t, repo, id).Attempts) != 3 {
+		t.Errorf("attempts = %d, want 3", len(mustGetDelivery(t, repo, id).Attempts))
+	}
+}